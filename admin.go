@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	adminStartCommand  = "start"
+	adminEndCommand    = "end"
+	adminExtendCommand = "extend"
+	adminCancelCommand = "cancel"
+	adminStatusCommand = "status"
+)
+
+type adminCommand struct {
+	name       string
+	channelRef string
+	extension  time.Duration
+}
+
+/* Admin commands look a lot like things people might say in answer to a
+ * stand-up question, so they have to parse exactly or they aren't commands.
+ */
+func parseAdminCommand(text string) (cmd adminCommand, ok bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return cmd, false
+	}
+	cmd.name = normaliseCommand(fields[0])
+	args := fields[1:]
+
+	switch cmd.name {
+	case adminStatusCommand:
+		return cmd, len(args) == 0
+
+	case adminStartCommand, adminEndCommand, adminCancelCommand:
+		if len(args) != 1 || !looksLikeChannel(args[0]) {
+			return cmd, false
+		}
+		cmd.channelRef = args[0]
+		return cmd, true
+
+	case adminExtendCommand:
+		if len(args) != 2 || !looksLikeChannel(args[0]) {
+			return cmd, false
+		}
+		cmd.channelRef = args[0]
+		cmd.extension, ok = parseMinutes(args[1])
+		return cmd, ok && cmd.extension > 0
+	}
+
+	return cmd, false
+}
+
+func looksLikeChannel(ref string) bool {
+	return strings.HasPrefix(ref, "#") || strings.HasPrefix(ref, "<#")
+}
+
+// parseMinutes accepts Go durations like 10m or 1h30m, or a bare number of
+// minutes.
+func parseMinutes(s string) (time.Duration, bool) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return time.Duration(n) * time.Minute, true
+	}
+	d, err := time.ParseDuration(s)
+	return d, err == nil
+}
+
+func (self *User) isAdmin() bool {
+	return self.Info().IsAdmin || self.Info().IsOwner || self.Info().IsPrimaryOwner ||
+		Settings.IsFacilitator(self.Info())
+}
+
+func (self *User) handleAdminCommand(text string) bool {
+	if self.manager.standups == nil || !self.isAdmin() {
+		return false
+	}
+	cmd, ok := parseAdminCommand(text)
+	if !ok {
+		return false
+	}
+	// starting a stand-up might well need to talk to us, so don't block
+	go self.runAdminCommand(cmd)
+	return true
+}
+
+func (self *User) runAdminCommand(cmd adminCommand) {
+	if cmd.name == adminStatusCommand {
+		self.tell(self.standupsStatus())
+		return
+	}
+
+	ch, err := self.manager.standups.FindChannel(cmd.channelRef)
+	if err != nil {
+		self.logger.Errorf("error finding channel %s: %s", cmd.channelRef, err)
+		self.tell(self.replyText(replyAdminChannelError, replyData{Channel: cmd.channelRef}))
+		return
+	}
+	if ch == nil {
+		self.tell(self.replyText(replyAdminUnknownChannel, replyData{Channel: cmd.channelRef}))
+		return
+	}
+
+	if cmd.name == adminStartCommand {
+		if !ch.IsMember {
+			self.tell(self.replyText(replyAdminNotMember, replyData{Channel: ch.Name}))
+		} else if _, err = self.manager.standups.Start(*ch); err == errStandupAlreadyRunning {
+			self.tell(self.replyText(replyAdminAlreadyRunning, replyData{Channel: ch.Name}))
+		} else if err == errShuttingDown {
+			self.tell(self.replyText(replyAdminShuttingDown, replyData{Channel: ch.Name}))
+		} else {
+			self.tell(self.replyText(replyAdminStarted, replyData{Channel: ch.Name}))
+		}
+		return
+	}
+
+	s := self.manager.standups.Running(ch.Id)
+	if s == nil {
+		self.tell(self.replyText(replyAdminNotRunning, replyData{Channel: ch.Name}))
+		return
+	}
+
+	switch cmd.name {
+	case adminEndCommand:
+		if s.End() {
+			self.tell(self.replyText(replyAdminEnded, replyData{Channel: ch.Name}))
+		} else {
+			self.tell(self.replyText(replyAdminNotRunning, replyData{Channel: ch.Name}))
+		}
+	case adminCancelCommand:
+		if s.Cancel() {
+			self.tell(self.replyText(replyAdminCancelled, replyData{Channel: ch.Name}))
+		} else {
+			self.tell(self.replyText(replyAdminNotRunning, replyData{Channel: ch.Name}))
+		}
+	case adminExtendCommand:
+		if deadline, ok := s.Extend(cmd.extension); ok {
+			self.tell(self.replyText(replyAdminExtended, replyData{Channel: ch.Name, Ends: deadline}))
+		} else {
+			self.tell(self.replyText(replyAdminNotRunning, replyData{Channel: ch.Name}))
+		}
+	}
+}
+
+func (self *User) standupsStatus() string {
+	running := self.manager.standups.All()
+	replies := self.replies()
+	if len(running) == 0 {
+		return replies.Render(replyAdminNothingRunning, nil)
+	}
+
+	var msg bytes.Buffer
+	for _, s := range running {
+		msg.WriteString(s.Progress(replies))
+	}
+	return msg.String()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"github.com/abourget/slack"
+	"testing"
+	"time"
+)
+
+func TestParseAdminCommand(t *testing.T) {
+	tests := []struct {
+		text string
+		cmd  adminCommand
+		ok   bool
+	}{
+		{"status", adminCommand{name: adminStatusCommand}, true},
+		{"Start #design", adminCommand{name: adminStartCommand, channelRef: "#design"}, true},
+		{"end <#C1|design>", adminCommand{name: adminEndCommand, channelRef: "<#C1|design>"}, true},
+		{"extend #design 10m", adminCommand{name: adminExtendCommand, channelRef: "#design", extension: 10 * time.Minute}, true},
+		{"extend #design 15", adminCommand{name: adminExtendCommand, channelRef: "#design", extension: 15 * time.Minute}, true},
+		// things people might say in answer to a question
+		{"status is good", adminCommand{}, false},
+		{"start on the API", adminCommand{}, false},
+		{"end of the sprint", adminCommand{}, false},
+		{"extend #design a bit", adminCommand{}, false},
+		{"extend #design -5m", adminCommand{}, false},
+		{"cancel", adminCommand{}, false},
+		{"", adminCommand{}, false},
+	}
+	for _, test := range tests {
+		cmd, ok := parseAdminCommand(test.text)
+		if ok != test.ok || ok && cmd != test.cmd {
+			t.Errorf("parseAdminCommand(%q) = %+v, %t; want %+v, %t", test.text, cmd, ok, test.cmd, test.ok)
+		}
+	}
+}
+
+func TestParseMinutes(t *testing.T) {
+	tests := map[string]time.Duration{"10": 10 * time.Minute, "1h30m": 90 * time.Minute, "45s": 45 * time.Second}
+	for s, want := range tests {
+		if d, ok := parseMinutes(s); !ok || d != want {
+			t.Errorf("parseMinutes(%q) = %s, %t; want %s", s, d, ok, want)
+		}
+	}
+	if _, ok := parseMinutes("soon"); ok {
+		t.Error("parsed soon")
+	}
+}
+
+func TestAdminCommands(t *testing.T) {
+	b := newTestBot(t, slack.User{Id: "U1", Name: "bob", IsAdmin: true}, slack.User{Id: "U2", Name: "amy"})
+	defer b.Close()
+	design, ops := testChannel("C1", "design", "U1", "U2"), testChannel("C2", "ops", "U1")
+	b.slack.channels = []slack.Channel{design, ops}
+
+	b.say("U1", "start #design")
+	b.slack.waitForDM(t, "U1", builtinReplies.Render(replyAdminStarted, replyData{Channel: "design"}))
+	b.slack.waitForDM(t, "U2", Questions[0])
+
+	// while bob's being asked, these need the "!"
+	b.say("U1", "!start #design")
+	b.slack.waitForDM(t, "U1", builtinReplies.Render(replyAdminAlreadyRunning, replyData{Channel: "design"}))
+	b.say("U1", "!opt out of #ops")
+	b.slack.waitForDM(t, "U1", builtinReplies.Render(replyOptedOut, replyData{Channel: "ops"}))
+	b.say("U1", "!end #nowhere")
+	b.slack.waitForDM(t, "U1", builtinReplies.Render(replyAdminUnknownChannel, replyData{Channel: "#nowhere"}))
+	b.say("U1", "!end #ops")
+	b.slack.waitForDM(t, "U1", builtinReplies.Render(replyAdminNotRunning, replyData{Channel: "ops"}))
+	b.say("U1", "!end #design")
+	b.slack.waitForDM(t, "U1", builtinReplies.Render(replyAdminEnded, replyData{Channel: "design"}))
+	b.waitReported(t)
+
+	b.say("U1", "status")
+	b.slack.waitForDM(t, "U1", AdminNothingRunningText)
+
+	// amy isn't an admin, so it's an answer to nothing; once she's had her
+	// stats, she's been heard
+	asked := len(b.slack.DMs("U2"))
+	b.say("U2", "start #ops")
+	b.say("U2", "stats")
+	waitFor(t, "amy's stats", func() bool { return len(b.slack.DMs("U2")) > asked })
+	if b.standups.Running("C2") != nil {
+		t.Error("amy started a stand-up")
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"github.com/abourget/slack"
+	"strings"
+)
+
+/* In the attachments layout, the summary is a heading, then an attachment for
+ * each person who answered, in their Slack colour and with their picture, with
+ * a field for each question they answered. Everyone who didn't answer is
+ * listed in one line at the end, so who's blocked stands out.
+ */
+type summaryMessage struct {
+	Text        string
+	Attachments []slack.Attachment
+	layout      string
+}
+
+// addFooter adds a line to the end of the summary.
+func (self *summaryMessage) addFooter(line string) {
+	if self.layout != layoutAttachments {
+		self.Text += "\n" + line
+		return
+	}
+	self.Attachments = append(self.Attachments, slack.Attachment{
+		Fallback:   line,
+		Text:       line,
+		MarkdownIn: []string{"text"},
+	})
+}
+
+// summaryMessage lays the summary out however the channel's configured to.
+func (self *Standup) summaryMessage(final bool) summaryMessage {
+	if self.config.Layout == layoutAttachments {
+		return self.summaryAttachments(final)
+	}
+	return summaryMessage{Text: self.summary(final), layout: layoutText}
+}
+
+func (self *Standup) summaryAttachments(final bool) summaryMessage {
+	self.userRepliesMutex.Lock()
+	defer self.userRepliesMutex.Unlock()
+
+	interrupted := self.finishReason == finishInterrupted
+	msg := summaryMessage{Attachments: []slack.Attachment{}, layout: layoutAttachments}
+	msg.Text = strings.TrimSpace(self.templates.Render(templateAttachmentsHeading, summaryData{
+		Channel:     self.Channel.Name,
+		Questions:   self.Questions,
+		Final:       final,
+		Interrupted: interrupted,
+	}))
+	footer := footerData{Interrupted: interrupted}
+
+	for _, user := range self.orderedUsers(final) {
+		anyReply := self.userReplies[user]
+		userName := fmt.Sprintf("<@%s|%s>", user.Info().Id, user.Info().Name)
+		switch reply := anyReply.(type) {
+		case userAnswersReply:
+			msg.Attachments = append(msg.Attachments, self.answersAttachment(user, userName, reply))
+		case userAbsentReply:
+			footer.Absent = append(footer.Absent, userName)
+		case userSkippedReply:
+			footer.Skipped = append(footer.Skipped, userName)
+		case userErrorReply:
+			footer.Errors = append(footer.Errors, userName)
+		}
+	}
+
+	for _, userId := range self.onLeave {
+		footer.OnLeave = append(footer.OnLeave, fmt.Sprintf("<@%s>", userId))
+	}
+	for _, userId := range self.away {
+		footer.Away = append(footer.Away, fmt.Sprintf("<@%s>", userId))
+	}
+	for _, userId := range self.excluded {
+		footer.Excluded = append(footer.Excluded,
+			fmt.Sprintf("<@%s> (%s)", userId, self.exclusions[userId]))
+	}
+
+	if line := strings.TrimSpace(self.templates.Render(templateAttachmentsFooter, footer)); line != "" {
+		msg.addFooter(line)
+	}
+	return msg
+}
+
+// must be called holding userRepliesMutex
+func (self *Standup) answersAttachment(user *User, userName string, reply userAnswersReply) slack.Attachment {
+	a := slack.Attachment{
+		AuthorName: user.Info().RealName,
+		AuthorIcon: user.Info().Profile.Image48,
+		MarkdownIn: []string{"text", "fields"},
+	}
+	if a.AuthorName == "" {
+		a.AuthorName = user.Info().Name
+	}
+	if took := self.tookText(user); took != "" {
+		a.AuthorName += fmt.Sprintf(" (%s)", took)
+	}
+	if user.Info().Color != "" {
+		a.Color = "#" + user.Info().Color
+	}
+
+	answered := sectionData{User: userName, Took: self.tookText(user)}
+	for i, answer := range reply {
+		if answer == "" {
+			answered.Partial = true
+			break
+		}
+		answered.Answers = append(answered.Answers, answer)
+		a.Fields = append(a.Fields, slack.AttachmentField{Title: self.Questions[i], Value: answer})
+	}
+	if answered.Partial {
+		a.Text = self.templates.Render(templateAttachmentsPartial, answered)
+	}
+	// for notifications and clients that can't show attachments
+	a.Fallback = strings.TrimSpace(self.templates.Render(templateAnswered, answered))
+	return a
+}
+
+/* postSummary posts the summary, or updates it if we've posted it already.
+ * The final one is always a new message, since Slack doesn't notify anyone of
+ * mentions in an edit, and it replaces the one we've been updating.
+ */
+func (self *Standup) postSummary(msg summaryMessage, final bool) error {
+	if self.summaryTimestamp != "" && !final {
+		return self.client.UpdateMessageText(self.Channel.Id, self.summaryTimestamp, msg.Text, msg.Attachments)
+	}
+	params := channelMessageParameters()
+	params.Attachments = msg.Attachments
+	_, ts, err := self.client.PostMessage(self.Channel.Id, msg.Text, params)
+	if err != nil {
+		return err
+	}
+	if self.summaryTimestamp != "" {
+		if _, _, err := self.client.DeleteMessage(self.Channel.Id, self.summaryTimestamp); err != nil {
+			self.logger.Errorf("error deleting the summary so far: %s", err)
+		}
+	}
+	self.summaryTimestamp = ts
+	return nil
+}
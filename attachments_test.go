@@ -0,0 +1,82 @@
+package main
+
+import (
+	"github.com/abourget/slack"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummaryAttachments(t *testing.T) {
+	amy := &User{info: slack.User{Id: "U1", Name: "amy", RealName: "Amy Pond", Color: "9f69e7"}}
+	amy.info.Profile.Image48 = "https://example.com/amy.png"
+	bob := &User{info: slack.User{Id: "U2", Name: "bob"}}
+	cat := &User{info: slack.User{Id: "U3", Name: "cat"}}
+	dan := &User{info: slack.User{Id: "U4", Name: "dan"}}
+	eve := &User{info: slack.User{Id: "U5", Name: "eve"}}
+
+	started := time.Now().Add(-time.Hour)
+	s := &Standup{
+		Channel:   slack.Channel{Name: "design"},
+		Started:   started,
+		Questions: Questions[:2],
+		config:    ChannelConfig{Layout: layoutAttachments, ShowTimes: true},
+		templates: builtinTemplates,
+		userReplies: map[*User]userReply{
+			amy: userAnswersReply{"Good", "Nothing"},
+			bob: userAnswersReply{"Fine", ""},
+			cat: userAbsentReply{},
+			dan: userSkippedReply{},
+			eve: userErrorReply{},
+		},
+		completedAt: map[*User]time.Time{amy: started.Add(5 * time.Minute)},
+		onLeave:     []string{"U6"},
+		away:        []string{"U7"},
+		excluded:    []string{"U8"},
+		exclusions:  map[string]string{"U8": "guests aren't asked in this channel"},
+	}
+
+	msg := s.summaryMessage(true)
+	if msg.Text != "<!here>: *BARKBARKBARK Stand-up done!*" {
+		t.Errorf("got heading %q", msg.Text)
+	}
+	if len(msg.Attachments) != 3 {
+		t.Fatalf("got %d attachments; want amy's, bob's and the footer", len(msg.Attachments))
+	}
+
+	a := msg.Attachments[0]
+	if a.AuthorName != "Amy Pond (5m0s)" || a.AuthorIcon != "https://example.com/amy.png" || a.Color != "#9f69e7" {
+		t.Errorf("got %q, %q in %q; want amy's name, how long she took, picture and colour", a.AuthorName, a.AuthorIcon, a.Color)
+	}
+	if len(a.Fields) != 2 || a.Fields[0].Title != Questions[0] || a.Fields[0].Value != "Good" ||
+		a.Fields[1].Title != Questions[1] || a.Fields[1].Value != "Nothing" || a.Text != "" {
+		t.Errorf("got fields %+v and text %q; want a field for each answer", a.Fields, a.Text)
+	}
+	if !strings.Contains(a.Fallback, "Good") {
+		t.Errorf("got fallback %q; want her answers", a.Fallback)
+	}
+
+	// bob's stopped part way, and has no colour
+	b := msg.Attachments[1]
+	if b.AuthorName != "bob" || b.Color != "" || len(b.Fields) != 1 || b.Text != AttachmentsPartialText {
+		t.Errorf("got %+v; want bob's one answer, and that he didn't finish", b)
+	}
+
+	footer := "Never replied: <@U3|cat>. Skipped: <@U4|dan>. Couldn't chat with: <@U5|eve>. On leave: <@U6>. " +
+		"Away: <@U7>. Not asked: <@U8> (guests aren't asked in this channel)."
+	if f := msg.Attachments[2]; f.Text != footer || f.Fallback != footer {
+		t.Errorf("got footer %q; want %q", f.Text, footer)
+	}
+
+	// a footer's added as an attachment of its own
+	msg.addFooter(":fire: <@U1> has answered 3 days in a row")
+	if n := len(msg.Attachments); n != 4 || msg.Attachments[3].Text != ":fire: <@U1> has answered 3 days in a row" {
+		t.Errorf("got %d attachments; want the streak last", n)
+	}
+
+	// while it's in progress, only who's finished
+	progress := s.summaryMessage(false)
+	if !strings.HasPrefix(progress.Text, "*Stand-up in progress!*") || progress.Attachments[0].AuthorName != "Amy Pond (5m0s)" {
+		t.Errorf("got %q, %+v", progress.Text, progress.Attachments)
+	}
+}
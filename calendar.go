@@ -0,0 +1,562 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/abourget/slack"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	icsDateFormat     = "20060102"
+	icsDateTimeFormat = "20060102T150405"
+)
+
+/* Calendars are iCalendar files, on disk or fetched over HTTP. All we need
+ * to know is whether an event covers a moment, so we read only as much of
+ * the format as that takes: events' start and end or duration, their
+ * timezones, and recurrence rules with BYDAY, like "every Monday and Friday"
+ * or "the last Friday of the month". We ignore BYMONTH and friends.
+ *
+ * All-day events, and times without a timezone, are "floating": they happen
+ * on that date, or at that time, wherever you are. So we compare them with
+ * the time where the person we're asking about is.
+ */
+type Calendar struct {
+	source string
+	events []calendarEvent
+}
+
+type calendarEvent struct {
+	summary    string
+	start      time.Time
+	end        time.Time
+	floating   bool
+	recurrence *calendarRecurrence
+}
+
+type calendarRecurrence struct {
+	freq      string
+	interval  int
+	count     int
+	until     time.Time
+	byDay     []calendarWeekday
+	weekStart time.Weekday
+}
+
+// A BYDAY entry is a weekday, and for monthly and yearly rules which of
+// them in the month or year: 1 for the first, -1 for the last, 0 for all.
+type calendarWeekday struct {
+	ordinal int
+	day     time.Weekday
+}
+
+var calendarWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// Don't go round forever on a daily rule from the dawn of time.
+const calendarMaxOccurrences = 100000
+
+var calendarHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+func LoadCalendar(source string) (*Calendar, error) {
+	var r io.ReadCloser
+
+	if url := strings.Replace(source, "webcal://", "https://", 1); strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		resp, err := calendarHTTPClient.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("fetching %s: %s", source, resp.Status)
+		}
+		r = resp.Body
+	} else {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		r = f
+	}
+	defer r.Close()
+
+	events, err := parseCalendar(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %s", source, err)
+	}
+	return &Calendar{source: source, events: events}, nil
+}
+
+// EventAt finds an event covering t, taking floating events where loc is.
+func (self *Calendar) EventAt(t time.Time, loc *time.Location) (summary string, ok bool) {
+	for _, e := range self.events {
+		if e.covers(t, loc) {
+			return e.summary, true
+		}
+	}
+	return "", false
+}
+
+func (self calendarEvent) covers(t time.Time, loc *time.Location) bool {
+	if self.floating {
+		// we read floating times as our own, so move t there from loc,
+		// keeping its clock
+		l := t.In(loc)
+		t = time.Date(l.Year(), l.Month(), l.Day(), l.Hour(), l.Minute(), l.Second(), l.Nanosecond(), time.Local)
+	}
+	if self.recurrence == nil {
+		return !t.Before(self.start) && t.Before(self.end)
+	}
+
+	// each occurrence lasts as many calendar days, and then as long, as
+	// the first, so all-day events stay all day across clock changes
+	days := 0
+	for !self.start.AddDate(0, 0, days+1).After(self.end) {
+		days++
+	}
+	rest := self.end.Sub(self.start.AddDate(0, 0, days))
+
+	n := 0
+	for period := 0; period < calendarMaxOccurrences; period++ {
+		from := self.recurrence.period(self.start, period)
+		if from.After(t) {
+			return false
+		}
+		for _, start := range self.recurrence.expand(from) {
+			if start.Before(self.start) {
+				continue
+			}
+			if self.recurrence.count > 0 && n >= self.recurrence.count {
+				return false
+			}
+			if !self.recurrence.until.IsZero() && start.After(self.recurrence.until) {
+				return false
+			}
+			if start.After(t) {
+				return false
+			}
+			if t.Before(start.AddDate(0, 0, days).Add(rest)) {
+				return true
+			}
+			n++
+		}
+	}
+	return false
+}
+
+// period finds when the nth period of the rule starts, from the first
+// occurrence. When we're picking days out of it, that's the start of its
+// week, month or year.
+func (self *calendarRecurrence) period(first time.Time, n int) time.Time {
+	n *= self.interval
+	switch {
+	case self.freq == "DAILY":
+		return first.AddDate(0, 0, n)
+	case self.freq == "WEEKLY" && len(self.byDay) == 0:
+		return first.AddDate(0, 0, 7*n)
+	case self.freq == "WEEKLY":
+		back := (int(first.Weekday()) - int(self.weekStart) + 7) % 7
+		return first.AddDate(0, 0, 7*n-back)
+	case self.freq == "MONTHLY" && len(self.byDay) == 0:
+		return first.AddDate(0, n, 0)
+	case self.freq == "MONTHLY":
+		return first.AddDate(0, 0, 1-first.Day()).AddDate(0, n, 0)
+	case len(self.byDay) == 0:
+		return first.AddDate(n, 0, 0)
+	default:
+		return first.AddDate(0, 0, 1-first.YearDay()).AddDate(n, 0, 0)
+	}
+}
+
+// expand finds the occurrences in a period, in order.
+func (self *calendarRecurrence) expand(from time.Time) (starts []time.Time) {
+	if len(self.byDay) == 0 {
+		return []time.Time{from}
+	}
+
+	var until time.Time
+	switch self.freq {
+	case "DAILY":
+		until = from.AddDate(0, 0, 1)
+	case "WEEKLY":
+		until = from.AddDate(0, 0, 7)
+	case "MONTHLY":
+		until = from.AddDate(0, 1, 0)
+	default:
+		until = from.AddDate(1, 0, 0)
+	}
+
+	var days []time.Time
+	for d := from; d.Before(until); d = d.AddDate(0, 0, 1) {
+		days = append(days, d)
+	}
+	for i, d := range days {
+		// which of its weekday it is in the period, from the start and
+		// from the end
+		nth, fromEnd := i/7+1, -((len(days)-1-i)/7 + 1)
+		for _, wd := range self.byDay {
+			if wd.day == d.Weekday() && (wd.ordinal == 0 || wd.ordinal == nth || wd.ordinal == fromEnd) {
+				starts = append(starts, d)
+				break
+			}
+		}
+	}
+	return
+}
+
+func parseCalendar(r io.Reader) (events []calendarEvent, err error) {
+	var event *calendarEvent
+	var hasEnd, allDay, floating, cancelled bool
+	var duration time.Duration
+	var durationDays int
+
+	for _, line := range unfoldCalendarLines(r) {
+		name, params, value := splitCalendarLine(line)
+
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			event = new(calendarEvent)
+			hasEnd, allDay, cancelled = false, false, false
+			duration, durationDays = -1, 0
+
+		case name == "END" && value == "VEVENT":
+			if event == nil {
+				continue
+			}
+			if event.start.IsZero() {
+				return nil, fmt.Errorf("event %q has no start", event.summary)
+			}
+			if !hasEnd && duration >= 0 {
+				event.end = event.start.AddDate(0, 0, durationDays).Add(duration)
+			} else if !hasEnd {
+				// all-day events without an end last the day, others
+				// no time at all
+				if allDay {
+					event.end = event.start.AddDate(0, 0, 1)
+				} else {
+					event.end = event.start
+				}
+			}
+			if !cancelled {
+				events = append(events, *event)
+			}
+			event = nil
+
+		case event == nil:
+			continue
+
+		case name == "SUMMARY":
+			event.summary = unescapeCalendarText(value)
+
+		case name == "STATUS":
+			cancelled = value == "CANCELLED"
+
+		case name == "DTSTART":
+			if event.start, allDay, floating, err = parseCalendarTime(params, value); err != nil {
+				return nil, err
+			}
+			event.floating = floating
+
+		case name == "DTEND":
+			if event.end, _, _, err = parseCalendarTime(params, value); err != nil {
+				return nil, err
+			}
+			hasEnd = true
+
+		case name == "DURATION":
+			if duration, durationDays, err = parseCalendarDuration(value); err != nil {
+				return nil, err
+			}
+
+		case name == "RRULE":
+			if event.recurrence, err = parseCalendarRecurrence(value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return events, nil
+}
+
+// Long lines are folded onto following lines that start with whitespace.
+func unfoldCalendarLines(r io.Reader) (lines []string) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+		} else if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return
+}
+
+// Lines look like NAME;PARAM=x;PARAM="y:z":VALUE
+func splitCalendarLine(line string) (name string, params map[string]string, value string) {
+	quoted := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return strings.ToUpper(line), nil, ""
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	name = strings.ToUpper(parts[0])
+	params = make(map[string]string)
+	for _, p := range parts[1:] {
+		if eq := strings.Index(p, "="); eq > 0 {
+			params[strings.ToUpper(p[:eq])] = strings.Trim(p[eq+1:], `"`)
+		}
+	}
+	return name, params, line[colon+1:]
+}
+
+// Floating times are read as our own; see Calendar.
+func parseCalendarTime(params map[string]string, value string) (t time.Time, allDay, floating bool, err error) {
+	if params["VALUE"] == "DATE" || len(value) == len(icsDateFormat) {
+		t, err = time.ParseInLocation(icsDateFormat, value, time.Local)
+		return t, true, true, err
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err = time.ParseInLocation(icsDateTimeFormat, strings.TrimSuffix(value, "Z"), time.UTC)
+		return
+	}
+
+	tzid := params["TZID"]
+	if tzid == "" {
+		t, err = time.ParseInLocation(icsDateTimeFormat, value, time.Local)
+		return t, false, true, err
+	}
+	loc := time.Local
+	if l, err := time.LoadLocation(tzid); err == nil {
+		loc = l
+	}
+	t, err = time.ParseInLocation(icsDateTimeFormat, value, loc)
+	return
+}
+
+// Durations look like P1D, PT1H30M or P1W. We keep days separate so they
+// stay calendar days across clock changes.
+func parseCalendarDuration(value string) (d time.Duration, days int, err error) {
+	s := strings.TrimPrefix(strings.TrimPrefix(value, "+"), "P")
+	if s == value || s == "" {
+		return 0, 0, fmt.Errorf("bad duration %s", value)
+	}
+
+	inTime := false
+	for s != "" {
+		if s[0] == 'T' {
+			inTime, s = true, s[1:]
+			continue
+		}
+		i := strings.IndexAny(s, "WDHMS")
+		if i < 1 {
+			return 0, 0, fmt.Errorf("bad duration %s", value)
+		}
+		n, err := strconv.Atoi(s[:i])
+		if err != nil {
+			return 0, 0, fmt.Errorf("bad duration %s", value)
+		}
+		switch {
+		case s[i] == 'W':
+			days += 7 * n
+		case s[i] == 'D':
+			days += n
+		case s[i] == 'H' && inTime:
+			d += time.Duration(n) * time.Hour
+		case s[i] == 'M' && inTime:
+			d += time.Duration(n) * time.Minute
+		case s[i] == 'S' && inTime:
+			d += time.Duration(n) * time.Second
+		default:
+			return 0, 0, fmt.Errorf("bad duration %s", value)
+		}
+		s = s[i+1:]
+	}
+	return
+}
+
+func parseCalendarRecurrence(value string) (r *calendarRecurrence, err error) {
+	r = &calendarRecurrence{interval: 1, weekStart: time.Monday}
+	for _, part := range strings.Split(value, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch strings.ToUpper(kv[0]) {
+		case "FREQ":
+			r.freq = strings.ToUpper(kv[1])
+		case "INTERVAL":
+			if r.interval, err = strconv.Atoi(kv[1]); err != nil || r.interval < 1 {
+				return nil, fmt.Errorf("bad recurrence interval %s", kv[1])
+			}
+		case "COUNT":
+			if r.count, err = strconv.Atoi(kv[1]); err != nil {
+				return nil, fmt.Errorf("bad recurrence count %s", kv[1])
+			}
+		case "UNTIL":
+			if r.until, _, _, err = parseCalendarTime(nil, kv[1]); err != nil {
+				return nil, fmt.Errorf("bad recurrence end %s", kv[1])
+			}
+		case "BYDAY":
+			for _, day := range strings.Split(strings.ToUpper(kv[1]), ",") {
+				wd, ok := parseCalendarWeekday(day)
+				if !ok {
+					return nil, fmt.Errorf("bad recurrence day %s", day)
+				}
+				r.byDay = append(r.byDay, wd)
+			}
+		case "WKST":
+			if wd, ok := calendarWeekdays[strings.ToUpper(kv[1])]; ok {
+				r.weekStart = wd
+			}
+		}
+	}
+
+	switch r.freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+		return r, nil
+	}
+	// anything more frequent can't be a holiday
+	return nil, nil
+}
+
+// BYDAY entries look like MO, 1MO or -1FR.
+func parseCalendarWeekday(s string) (wd calendarWeekday, ok bool) {
+	if len(s) < 2 {
+		return wd, false
+	}
+	if wd.day, ok = calendarWeekdays[s[len(s)-2:]]; !ok {
+		return wd, false
+	}
+	if ordinal := s[:len(s)-2]; ordinal != "" {
+		n, err := strconv.Atoi(strings.TrimPrefix(ordinal, "+"))
+		if err != nil || n == 0 || n > 53 || n < -53 {
+			return wd, false
+		}
+		wd.ordinal = n
+	}
+	return wd, true
+}
+
+func unescapeCalendarText(s string) string {
+	var out bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			if s[i] == 'n' || s[i] == 'N' {
+				out.WriteByte('\n')
+			} else {
+				out.WriteByte(s[i])
+			}
+			continue
+		}
+		out.WriteByte(s[i])
+	}
+	return out.String()
+}
+
+/* Calendars holds everything from the config: holidays for everyone, and
+ * leave for particular people, keyed by user id or name. When we're running
+ * for days on end, we reload it every day.
+ */
+type Calendars struct {
+	holidays []*Calendar
+	leave    map[string][]*Calendar
+	mutex    sync.RWMutex
+}
+
+func LoadCalendars(config *Config) (cals *Calendars, errs []error) {
+	cals = &Calendars{leave: make(map[string][]*Calendar)}
+	errs = cals.Reload(config)
+	return
+}
+
+// Reload doesn't give up on a calendar it can't load; we'd rather run a
+// stand-up on a holiday than not run one at all. It says what went wrong.
+func (self *Calendars) Reload(config *Config) (errs []error) {
+	holidays := make([]*Calendar, 0, len(config.HolidayCalendars))
+	leave := make(map[string][]*Calendar)
+
+	for _, source := range config.HolidayCalendars {
+		if cal, err := LoadCalendar(source); err != nil {
+			errs = append(errs, fmt.Errorf("holiday calendar: %s", err))
+		} else {
+			holidays = append(holidays, cal)
+		}
+	}
+	for user, sources := range config.LeaveCalendars {
+		user = strings.TrimPrefix(user, "@")
+		for _, source := range sources {
+			if cal, err := LoadCalendar(source); err != nil {
+				errs = append(errs, fmt.Errorf("leave calendar for %s: %s", user, err))
+			} else {
+				leave[user] = append(leave[user], cal)
+			}
+		}
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.holidays, self.leave = holidays, leave
+	return
+}
+
+// Holiday says whether t is in a holiday, where loc is.
+func (self *Calendars) Holiday(t time.Time, loc *time.Location) (summary string, ok bool) {
+	if self == nil {
+		return "", false
+	}
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	for _, cal := range self.holidays {
+		if summary, ok = cal.EventAt(t, loc); ok {
+			return
+		}
+	}
+	return "", false
+}
+
+// Away says whether someone's on leave at t, or it's a holiday where they
+// are.
+func (self *Calendars) Away(user slack.User, t time.Time) bool {
+	if self == nil {
+		return false
+	}
+	loc := userLocation(user)
+	if _, ok := self.Holiday(t, loc); ok {
+		return true
+	}
+
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	for _, key := range []string{user.Id, user.Name} {
+		for _, cal := range self.leave[key] {
+			if _, ok := cal.EventAt(t, loc); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
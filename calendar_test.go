@@ -0,0 +1,208 @@
+package main
+
+import (
+	"github.com/abourget/slack"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+var (
+	london   = mustLoadLocation("Europe/London")
+	newYork  = mustLoadLocation("America/New_York")
+	auckland = mustLoadLocation("Pacific/Auckland")
+)
+
+func testCalendar(t *testing.T, events ...string) *Calendar {
+	ics := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n" + strings.Join(events, "") + "END:VCALENDAR\r\n"
+	parsed, err := parseCalendar(strings.NewReader(ics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Calendar{source: "test", events: parsed}
+}
+
+func TestCalendarEventAt(t *testing.T) {
+	tests := []struct {
+		name  string
+		event string
+		at    time.Time
+		loc   *time.Location
+		want  bool
+	}{
+		{
+			"an all-day holiday",
+			"BEGIN:VEVENT\r\nSUMMARY:Bank holiday\r\nDTSTART;VALUE=DATE:20261225\r\nEND:VEVENT\r\n",
+			time.Date(2026, 12, 25, 9, 30, 0, 0, london), london, true,
+		},
+		{
+			"the day after it",
+			"BEGIN:VEVENT\r\nSUMMARY:Bank holiday\r\nDTSTART;VALUE=DATE:20261225\r\nEND:VEVENT\r\n",
+			time.Date(2026, 12, 26, 9, 30, 0, 0, london), london, false,
+		},
+		{
+			// it's still the 24th in New York when it's Christmas in London
+			"an all-day holiday where they are",
+			"BEGIN:VEVENT\r\nSUMMARY:Christmas\r\nDTSTART;VALUE=DATE:20261225\r\nDTEND;VALUE=DATE:20261226\r\nEND:VEVENT\r\n",
+			time.Date(2026, 12, 25, 2, 0, 0, 0, london), newYork, false,
+		},
+		{
+			"an all-day holiday where they are, in our evening",
+			"BEGIN:VEVENT\r\nSUMMARY:Christmas\r\nDTSTART;VALUE=DATE:20261225\r\nDTEND;VALUE=DATE:20261226\r\nEND:VEVENT\r\n",
+			time.Date(2026, 12, 24, 20, 0, 0, 0, london), auckland, true,
+		},
+		{
+			"a time in a timezone",
+			"BEGIN:VEVENT\r\nSUMMARY:Offsite\r\nDTSTART;TZID=America/New_York:20261019T090000\r\nDURATION:PT3H\r\nEND:VEVENT\r\n",
+			time.Date(2026, 10, 19, 15, 0, 0, 0, london), london, true,
+		},
+		{
+			// wherever they are
+			"a time in UTC",
+			"BEGIN:VEVENT\r\nSUMMARY:Offsite\r\nDTSTART:20261019T090000Z\r\nDTEND:20261019T100000Z\r\nEND:VEVENT\r\n",
+			time.Date(2026, 10, 19, 10, 30, 0, 0, london), newYork, true,
+		},
+		{
+			"a floating time, where they are",
+			"BEGIN:VEVENT\r\nSUMMARY:Dentist\r\nDTSTART:20261019T090000\r\nDURATION:PT1H\r\nEND:VEVENT\r\n",
+			time.Date(2026, 10, 19, 9, 30, 0, 0, auckland), auckland, true,
+		},
+		{
+			"a cancelled event",
+			"BEGIN:VEVENT\r\nSUMMARY:Away day\r\nSTATUS:CANCELLED\r\nDTSTART;VALUE=DATE:20261019\r\nEND:VEVENT\r\n",
+			time.Date(2026, 10, 19, 9, 30, 0, 0, london), london, false,
+		},
+		{
+			"a weekly event, on another day of the week",
+			"BEGIN:VEVENT\r\nSUMMARY:Part time\r\nDTSTART;VALUE=DATE:20261005\r\nRRULE:FREQ=WEEKLY\r\nEND:VEVENT\r\n",
+			time.Date(2026, 10, 23, 9, 30, 0, 0, london), london, false,
+		},
+		{
+			"a weekly event on Mondays and Fridays, on a Friday",
+			"BEGIN:VEVENT\r\nSUMMARY:Part time\r\nDTSTART;VALUE=DATE:20261005\r\nRRULE:FREQ=WEEKLY;BYDAY=MO,FR\r\nEND:VEVENT\r\n",
+			time.Date(2026, 10, 23, 9, 30, 0, 0, london), london, true,
+		},
+		{
+			"a weekly event on Mondays and Fridays, on a Wednesday",
+			"BEGIN:VEVENT\r\nSUMMARY:Part time\r\nDTSTART;VALUE=DATE:20261005\r\nRRULE:FREQ=WEEKLY;BYDAY=MO,FR\r\nEND:VEVENT\r\n",
+			time.Date(2026, 10, 21, 9, 30, 0, 0, london), london, false,
+		},
+		{
+			"every other week, in a week off",
+			"BEGIN:VEVENT\r\nSUMMARY:Part time\r\nDTSTART;VALUE=DATE:20261005\r\nRRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR\r\nEND:VEVENT\r\n",
+			time.Date(2026, 10, 16, 9, 30, 0, 0, london), london, false,
+		},
+		{
+			"every other week, in a week on",
+			"BEGIN:VEVENT\r\nSUMMARY:Part time\r\nDTSTART;VALUE=DATE:20261005\r\nRRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR\r\nEND:VEVENT\r\n",
+			time.Date(2026, 10, 23, 9, 30, 0, 0, london), london, true,
+		},
+		{
+			"after the last of a count",
+			"BEGIN:VEVENT\r\nSUMMARY:Part time\r\nDTSTART;VALUE=DATE:20261005\r\nRRULE:FREQ=WEEKLY;COUNT=3;BYDAY=MO,FR\r\nEND:VEVENT\r\n",
+			time.Date(2026, 10, 16, 9, 30, 0, 0, london), london, false,
+		},
+		{
+			"the last of a count",
+			"BEGIN:VEVENT\r\nSUMMARY:Part time\r\nDTSTART;VALUE=DATE:20261005\r\nRRULE:FREQ=WEEKLY;COUNT=3;BYDAY=MO,FR\r\nEND:VEVENT\r\n",
+			time.Date(2026, 10, 12, 9, 30, 0, 0, london), london, true,
+		},
+		{
+			"after it's over",
+			"BEGIN:VEVENT\r\nSUMMARY:Part time\r\nDTSTART;VALUE=DATE:20261005\r\nRRULE:FREQ=DAILY;UNTIL=20261009\r\nEND:VEVENT\r\n",
+			time.Date(2026, 10, 12, 9, 30, 0, 0, london), london, false,
+		},
+		{
+			"the last Friday of the month",
+			"BEGIN:VEVENT\r\nSUMMARY:Hack day\r\nDTSTART;VALUE=DATE:20260130\r\nRRULE:FREQ=MONTHLY;BYDAY=-1FR\r\nEND:VEVENT\r\n",
+			time.Date(2026, 10, 30, 9, 30, 0, 0, london), london, true,
+		},
+		{
+			"another Friday of the month",
+			"BEGIN:VEVENT\r\nSUMMARY:Hack day\r\nDTSTART;VALUE=DATE:20260130\r\nRRULE:FREQ=MONTHLY;BYDAY=-1FR\r\nEND:VEVENT\r\n",
+			time.Date(2026, 10, 23, 9, 30, 0, 0, london), london, false,
+		},
+		{
+			"the first Monday in the month",
+			"BEGIN:VEVENT\r\nSUMMARY:Planning\r\nDTSTART;TZID=Europe/London:20260105T090000\r\nDURATION:PT2H\r\nRRULE:FREQ=MONTHLY;BYDAY=1MO\r\nEND:VEVENT\r\n",
+			time.Date(2026, 11, 2, 10, 0, 0, 0, london), london, true,
+		},
+		{
+			"a yearly date",
+			"BEGIN:VEVENT\r\nSUMMARY:New year\r\nDTSTART;VALUE=DATE:20200101\r\nRRULE:FREQ=YEARLY\r\nEND:VEVENT\r\n",
+			time.Date(2027, 1, 1, 9, 30, 0, 0, london), london, true,
+		},
+	}
+	for _, test := range tests {
+		cal := testCalendar(t, test.event)
+		if _, got := cal.EventAt(test.at, test.loc); got != test.want {
+			t.Errorf("%s: EventAt(%s in %s) = %t; want %t", test.name, test.at, test.loc, got, test.want)
+		}
+	}
+}
+
+func TestParseCalendar(t *testing.T) {
+	cal := testCalendar(t,
+		"BEGIN:VEVENT\r\nSUMMARY:A long\\, folded\r\n  summary\r\nDTSTART;VALUE=DATE:20261019\r\nDURATION:P1W\r\nEND:VEVENT\r\n",
+		"BEGIN:VEVENT\r\nSUMMARY:Minutely\r\nDTSTART:20261019T090000Z\r\nRRULE:FREQ=MINUTELY\r\nEND:VEVENT\r\n")
+
+	if len(cal.events) != 2 {
+		t.Fatalf("got %d events; want 2", len(cal.events))
+	}
+	e := cal.events[0]
+	if e.summary != "A long, folded summary" || !e.floating || e.end.Sub(e.start) < 6*24*time.Hour {
+		t.Errorf("got %+v", e)
+	}
+	// too frequent to be a holiday, so it's only the once
+	if cal.events[1].recurrence != nil {
+		t.Errorf("got %+v for a minutely event; want no recurrence", cal.events[1].recurrence)
+	}
+
+	for _, bad := range []string{
+		"BEGIN:VEVENT\r\nSUMMARY:No start\r\nEND:VEVENT\r\n",
+		"BEGIN:VEVENT\r\nDTSTART;VALUE=DATE:20261019\r\nDURATION:1D\r\nEND:VEVENT\r\n",
+		"BEGIN:VEVENT\r\nDTSTART;VALUE=DATE:20261019\r\nRRULE:FREQ=WEEKLY;BYDAY=XX\r\nEND:VEVENT\r\n",
+		"BEGIN:VEVENT\r\nDTSTART;VALUE=DATE:20261019\r\nRRULE:FREQ=WEEKLY;INTERVAL=0\r\nEND:VEVENT\r\n",
+	} {
+		if _, err := parseCalendar(strings.NewReader(bad)); err == nil {
+			t.Errorf("parsed %q; want an error", bad)
+		}
+	}
+}
+
+func TestCalendarsAway(t *testing.T) {
+	holiday := testCalendar(t, "BEGIN:VEVENT\r\nSUMMARY:Christmas\r\nDTSTART;VALUE=DATE:20261225\r\nEND:VEVENT\r\n")
+	leave := testCalendar(t, "BEGIN:VEVENT\r\nSUMMARY:Off\r\nDTSTART;VALUE=DATE:20261021\r\nEND:VEVENT\r\n")
+	cals := &Calendars{holidays: []*Calendar{holiday}, leave: map[string][]*Calendar{"peter": {leave}}}
+
+	peter := slack.User{Id: "U1", Name: "peter", TZ: "Europe/London"}
+	kiri := slack.User{Id: "U2", Name: "kiri", TZ: "Pacific/Auckland"}
+	tests := []struct {
+		user slack.User
+		at   time.Time
+		want bool
+	}{
+		{peter, time.Date(2026, 10, 21, 9, 30, 0, 0, london), true},
+		{kiri, time.Date(2026, 10, 21, 9, 30, 0, 0, auckland), false},
+		{peter, time.Date(2026, 12, 24, 20, 0, 0, 0, london), false},
+		{kiri, time.Date(2026, 12, 24, 20, 0, 0, 0, london), true},
+	}
+	for _, test := range tests {
+		if got := cals.Away(test.user, test.at); got != test.want {
+			t.Errorf("Away(%s, %s) = %t; want %t", test.user.Name, test.at, got, test.want)
+		}
+	}
+
+	var none *Calendars
+	if none.Away(peter, time.Now()) {
+		t.Error("away with no calendars")
+	}
+}
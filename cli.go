@@ -0,0 +1,472 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/abourget/slack"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Version is set when building releases, with -ldflags "-X main.Version=1.2.3"
+var Version = "dev"
+
+const usageText = `Usage: tilly [command] [flags]
+
+Commands:
+  run              run today's stand-ups and exit; the default
+  serve            stay connected, running stand-ups when asked, or daily --at a time
+  channels         list the channels I'm in and who I'd ask in each
+  validate-config  check the config file and the calendars it mentions
+  dashboard        serve the stand-up history dashboard
+  version          say which version I am
+
+Run "tilly <command> -h" to see its flags. Flags take precedence over the
+environment variables they stand in for.
+`
+
+var commands = map[string]func(args []string){
+	"run":             runCommand,
+	"serve":           serveCommand,
+	"channels":        channelsCommand,
+	"validate-config": validateConfigCommand,
+	"dashboard":       dashboardCommand,
+	"version":         versionCommand,
+	"help":            helpCommand,
+}
+
+type options struct {
+	configFile      string
+	logLevel        string
+	logFormat       string
+	token           string
+	preferencesFile string
+	historyFile     string
+	metricsAddr     string
+	streaks         int
+	shutdownTimeout time.Duration
+	weekdayOnly     bool
+	channel         string
+	dryRun          bool
+	at              string
+	dashboardAddr   string
+
+	flags *flag.FlagSet
+	// environment variables we couldn't use as flags' defaults
+	badEnv []badEnvVar
+}
+
+type badEnvVar struct {
+	flag string
+	err  error
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func (self *options) flagSet(command string) *flag.FlagSet {
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	self.flags = fs
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: tilly %s [flags]\n", command)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&self.configFile, "config", envOr("TILLY_CONFIG", DefaultConfigFile),
+		"config file (TILLY_CONFIG)")
+	fs.StringVar(&self.logLevel, "log-level", envOr("TILLY_LOG_LEVEL", ""),
+		"debug, info, warn or error (TILLY_LOG_LEVEL)")
+	fs.StringVar(&self.logFormat, "log-format", envOr("TILLY_LOG_FORMAT", "json"),
+		"json or text (TILLY_LOG_FORMAT)")
+	return fs
+}
+
+// slackFlags are for commands that talk to Slack.
+func (self *options) slackFlags(fs *flag.FlagSet) {
+	// not defaulting to SLACK_TOKEN, so -h doesn't print it
+	fs.StringVar(&self.token, "token", "", "Slack bot token (SLACK_TOKEN)")
+	fs.StringVar(&self.preferencesFile, "preferences", envOr("TILLY_PREFERENCES_FILE", DefaultPreferencesFile),
+		"people's preferences file (TILLY_PREFERENCES_FILE)")
+	fs.BoolVar(&self.weekdayOnly, "weekday-only", os.Getenv("TILLY_WEEKDAY_ONLY") != "",
+		"don't run stand-ups at weekends (TILLY_WEEKDAY_ONLY)")
+}
+
+// standupFlags are for commands that run stand-ups.
+func (self *options) standupFlags(fs *flag.FlagSet) {
+	self.slackFlags(fs)
+	fs.StringVar(&self.historyFile, "history", envOr("TILLY_HISTORY_FILE", DefaultHistoryFile),
+		"stand-up history file (TILLY_HISTORY_FILE)")
+	fs.StringVar(&self.metricsAddr, "metrics-addr", os.Getenv("TILLY_METRICS_ADDR"),
+		"address to serve metrics and health checks on (TILLY_METRICS_ADDR)")
+
+	streaks := 0
+	if s := os.Getenv("TILLY_SUMMARY_STREAKS"); s != "" {
+		if n, err := strconv.Atoi(s); err != nil {
+			self.badEnv = append(self.badEnv, badEnvVar{"streaks",
+				fmt.Errorf("TILLY_SUMMARY_STREAKS must be a number of days: %s", err)})
+		} else {
+			streaks = n
+		}
+	}
+	fs.IntVar(&self.streaks, "streaks", streaks,
+		"mention streaks of this many days in summaries; 0 for none (TILLY_SUMMARY_STREAKS)")
+
+	// Heroku and Kubernetes both give us 30 seconds after SIGTERM
+	shutdownTimeout := 25 * time.Second
+	if s := os.Getenv("TILLY_SHUTDOWN_TIMEOUT"); s != "" {
+		if d, err := time.ParseDuration(s); err != nil {
+			self.badEnv = append(self.badEnv, badEnvVar{"shutdown-timeout",
+				fmt.Errorf("TILLY_SHUTDOWN_TIMEOUT must be a duration like 25s: %s", err)})
+		} else {
+			shutdownTimeout = d
+		}
+	}
+	fs.DurationVar(&self.shutdownTimeout, "shutdown-timeout", shutdownTimeout,
+		"how long to spend wrapping up stand-ups when told to stop (TILLY_SHUTDOWN_TIMEOUT)")
+}
+
+// envError says what's wrong with the environment, once the flags are
+// parsed. A flag given on the command line makes up for a bad variable.
+func (self *options) envError() error {
+	given := make(map[string]bool)
+	self.flags.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for _, bad := range self.badEnv {
+		if !given[bad.flag] {
+			return bad.err
+		}
+	}
+	return nil
+}
+
+// setUp applies the flags every command has.
+func (self *options) setUp() {
+	if self.logLevel != "" {
+		if err := SetLogLevel(self.logLevel); err != nil {
+			Log.Fatalf("%s", err)
+		}
+	}
+	if err := SetLogFormat(self.logFormat); err != nil {
+		Log.Fatalf("%s", err)
+	}
+	if err := self.envError(); err != nil {
+		Log.Fatalf("%s", err)
+	}
+
+	var err error
+	if Settings, err = LoadConfig(self.configFile); err != nil {
+		Log.Fatalf("Couldn't load config from %s: %s", self.configFile, err)
+	}
+	SummaryStreakMinimum = self.streaks
+}
+
+func (self *options) login() *AuthedSlack {
+	if self.token == "" {
+		self.token = os.Getenv("SLACK_TOKEN")
+	}
+	if self.token == "" {
+		Log.Fatalf("You must provide a Slack token, with --token or SLACK_TOKEN")
+	}
+
+	// the Slack library uses the default client for everything
+	http.DefaultClient.Transport = newSlackTransport(http.DefaultTransport)
+	client := slack.New(self.token)
+
+	auth, err := client.AuthTest()
+	if err != nil {
+		Log.Fatalf("Couldn't log in: %s", err)
+	}
+	return &AuthedSlack{Client: client, UserId: auth.UserId, Token: self.token}
+}
+
+func (self *options) loadPreferences() *Preferences {
+	preferences, err := LoadPreferences(self.preferencesFile)
+	if err != nil {
+		Log.Fatalf("Couldn't load preferences: %s", err)
+	}
+	return preferences
+}
+
+func loadCalendars() *Calendars {
+	calendars, errs := LoadCalendars(Settings)
+	for _, err := range errs {
+		Log.Errorf("Couldn't load %s", err)
+	}
+	return calendars
+}
+
+// skipToday says why we shouldn't run stand-ups today, if we shouldn't.
+func (self *options) skipToday(calendars *Calendars, now time.Time) (reason string, skip bool) {
+	if day := now.Weekday(); self.weekdayOnly && (day < time.Monday || day > time.Friday) {
+		return "it's the weekend and I'm set to only run on a weekday", true
+	}
+	if holiday, ok := calendars.Holiday(now, time.Local); ok {
+		return fmt.Sprintf("it's a holiday: %s", holiday), true
+	}
+	return "", false
+}
+
+// chooseChannels finds the channels to run stand-ups in: the one named, or
+// all of ours.
+func chooseChannels(client *AuthedSlack, name string) ([]slack.Channel, error) {
+	chs, err := client.GetChannels(true)
+	if err != nil {
+		return nil, err
+	}
+
+	chosen := make([]slack.Channel, 0, len(chs))
+	name = strings.TrimPrefix(name, "#")
+	for _, ch := range chs {
+		if name == "" && isStandupChannel(ch) {
+			chosen = append(chosen, ch)
+		} else if name != "" && (ch.Name == name || ch.Id == name) {
+			if !ch.IsMember {
+				return nil, fmt.Errorf("I'm not in #%s", ch.Name)
+			}
+			return []slack.Channel{ch}, nil
+		}
+	}
+	if name != "" {
+		return nil, fmt.Errorf("there's no channel called #%s", name)
+	}
+	return chosen, nil
+}
+
+/* bot is everything that goes into running stand-ups, wired together and
+ * connected to Slack.
+ */
+type bot struct {
+	client    *AuthedSlack
+	calendars *Calendars
+	standups  *StandupManager
+	events    *EventReceiver
+	reported  *sync.WaitGroup
+}
+
+func startBot(opts *options, client *AuthedSlack, preferences *Preferences, calendars *Calendars) *bot {
+	if opts.metricsAddr != "" {
+		go serveMetrics(opts.metricsAddr)
+	}
+
+	history := NewHistory(opts.historyFile)
+	userManager := NewUserManager(client, history, preferences, calendars)
+	reported := new(sync.WaitGroup)
+	standups := NewStandupManager(client, userManager, history, reported)
+	channelCommands := NewChannelCommands(client, standups, userManager)
+	eventReceiver := NewEventReceiver(client.NewRTM(), userManager, standups, channelCommands, client.UserId)
+	go eventReceiver.Start()
+
+	return &bot{client: client, calendars: calendars, standups: standups, events: eventReceiver, reported: reported}
+}
+
+func (self *bot) startStandups(chs []slack.Channel) {
+	for _, ch := range chs {
+		if _, err := self.standups.Start(ch); err != nil {
+			Log.With("channel", ch.Name).Errorf("Couldn't start stand-up: %s", err)
+		}
+	}
+}
+
+/* wait blocks until we're told to stop, by SIGINT or SIGTERM, or until every
+ * stand-up has reported if untilReported. When we're told to stop we wrap up
+ * the stand-ups that are running, posting what we've got, and give up after
+ * the timeout. A second signal gives up straight away.
+ */
+func (self *bot) wait(untilReported bool, timeout time.Duration) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	var reported <-chan struct{}
+	if untilReported {
+		reported = self.allReported()
+	}
+	select {
+	case <-reported:
+		self.events.Stop()
+		return
+	case sig := <-signals:
+		Log.Infof("Got %s; wrapping up", sig)
+	}
+
+	giveUp := time.After(timeout)
+	if n := self.standups.Shutdown(); n > 0 {
+		Log.Infof("Interrupted %d stand-ups; posting what we've got", n)
+	}
+	select {
+	case <-self.allReported():
+		Log.Infof("All wrapped up")
+	case sig := <-signals:
+		Log.Fatalf("Got %s again; exiting now", sig)
+	case <-giveUp:
+		Log.Fatalf("Couldn't wrap up stand-ups within %s; exiting anyway", timeout)
+	}
+	self.events.Stop()
+}
+
+func (self *bot) allReported() <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		self.reported.Wait()
+		close(done)
+	}()
+	return done
+}
+
+// runDaily starts stand-ups in all our channels at the same time every day.
+func (self *bot) runDaily(opts *options) {
+	for {
+		next := localStartTime(opts.at, time.Local, time.Now(), 0)
+		Log.Infof("Next stand-ups at %s", next.Format("Mon 2 Jan 15:04"))
+		time.Sleep(next.Sub(time.Now()))
+
+		for _, err := range self.calendars.Reload(Settings) {
+			Log.Errorf("Couldn't load %s", err)
+		}
+		if reason, skip := opts.skipToday(self.calendars, time.Now()); skip {
+			Log.Infof("Not running stand-ups today; %s", reason)
+			continue
+		}
+
+		chs, err := chooseChannels(self.client, "")
+		if err != nil {
+			Log.Errorf("Couldn't get channels: %s", err)
+			continue
+		}
+		self.startStandups(chs)
+	}
+}
+
+func runCommand(args []string) {
+	opts := new(options)
+	fs := opts.flagSet("run")
+	opts.standupFlags(fs)
+	fs.StringVar(&opts.channel, "channel", "", "only run the stand-up in this channel")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "print who'd be asked what, without sending anything")
+	fs.Parse(args)
+	opts.setUp()
+
+	client := opts.login()
+	preferences := opts.loadPreferences()
+	calendars := loadCalendars()
+
+	chs, err := chooseChannels(client, opts.channel)
+	if err != nil {
+		Log.Fatalf("Couldn't get channels: %s", err)
+	}
+
+	reason, skip := opts.skipToday(calendars, time.Now())
+	if opts.dryRun {
+		if skip {
+			fmt.Printf("No stand-ups would run today; %s.\n", reason)
+		} else if err = dryRun(client, preferences, calendars, chs, os.Stdout); err != nil {
+			Log.Fatalf("Dry run failed: %s", err)
+		}
+		return
+	}
+	if skip {
+		Log.Fatalf("Exiting; %s", reason)
+	}
+
+	b := startBot(opts, client, preferences, calendars)
+	b.startStandups(chs)
+	b.wait(true, opts.shutdownTimeout)
+}
+
+func serveCommand(args []string) {
+	opts := new(options)
+	fs := opts.flagSet("serve")
+	opts.standupFlags(fs)
+	fs.StringVar(&opts.at, "at", os.Getenv("TILLY_RUN_AT"),
+		"start stand-ups in all my channels at this time every day, like 09:30 (TILLY_RUN_AT)")
+	fs.Parse(args)
+	opts.setUp()
+
+	if opts.at != "" {
+		if _, err := time.Parse(localTimeFormat, opts.at); err != nil {
+			Log.Fatalf("--at must be a time like 09:30: %s", err)
+		}
+	}
+
+	client := opts.login()
+	b := startBot(opts, client, opts.loadPreferences(), loadCalendars())
+	if opts.at != "" {
+		go b.runDaily(opts)
+	}
+	Log.Infof("Serving; mention me or DM me to start stand-ups")
+	b.wait(false, opts.shutdownTimeout)
+}
+
+func channelsCommand(args []string) {
+	opts := new(options)
+	fs := opts.flagSet("channels")
+	opts.slackFlags(fs)
+	fs.Parse(args)
+	opts.setUp()
+
+	client := opts.login()
+	chs, err := chooseChannels(client, "")
+	if err != nil {
+		Log.Fatalf("Couldn't get channels: %s", err)
+	}
+	if err = listChannels(client, opts.loadPreferences(), loadCalendars(), chs, os.Stdout); err != nil {
+		Log.Fatalf("Couldn't list channels: %s", err)
+	}
+}
+
+func validateConfigCommand(args []string) {
+	opts := new(options)
+	fs := opts.flagSet("validate-config")
+	fs.Parse(args)
+
+	if _, err := os.Stat(opts.configFile); os.IsNotExist(err) && opts.configFile == DefaultConfigFile {
+		fmt.Printf("There's no %s, so I'd use the defaults.\n", opts.configFile)
+		return
+	}
+	config, err := LoadConfig(opts.configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", opts.configFile, err)
+		os.Exit(1)
+	}
+	if _, errs := LoadCalendars(config); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", opts.configFile, err)
+		}
+		os.Exit(1)
+	}
+	fmt.Printf("%s is OK.\n", opts.configFile)
+}
+
+func dashboardCommand(args []string) {
+	opts := new(options)
+	fs := opts.flagSet("dashboard")
+	fs.StringVar(&opts.historyFile, "history", envOr("TILLY_HISTORY_FILE", DefaultHistoryFile),
+		"stand-up history file (TILLY_HISTORY_FILE)")
+	fs.StringVar(&opts.dashboardAddr, "addr", envOr("TILLY_DASHBOARD_ADDR", ":"+envOr("PORT", "8080")),
+		"address to serve the dashboard on (TILLY_DASHBOARD_ADDR, or PORT)")
+	fs.Parse(args)
+	opts.setUp()
+
+	secret := os.Getenv("TILLY_DASHBOARD_SECRET")
+	if secret == "" {
+		Log.Fatalf("You must provide a TILLY_DASHBOARD_SECRET environment variable to serve the dashboard")
+	}
+
+	Log.Infof("Serving dashboard on %s", opts.dashboardAddr)
+	Log.Fatalf("%s", http.ListenAndServe(opts.dashboardAddr, NewDashboard(NewHistory(opts.historyFile), secret)))
+}
+
+func versionCommand(args []string) {
+	fmt.Printf("tilly %s\n", Version)
+}
+
+func helpCommand(args []string) {
+	fmt.Print(usageText)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStandupFlagsFromEnvironment(t *testing.T) {
+	defer os.Unsetenv("TILLY_SUMMARY_STREAKS")
+	defer os.Unsetenv("TILLY_SHUTDOWN_TIMEOUT")
+
+	tests := []struct {
+		streaks, timeout string
+		args             []string
+		wantStreaks      int
+		wantTimeout      time.Duration
+		ok               bool
+	}{
+		{"", "", nil, 0, 25 * time.Second, true},
+		{"5", "10s", nil, 5, 10 * time.Second, true},
+		{"5", "10s", []string{"-streaks", "3"}, 3, 10 * time.Second, true},
+		{"lots", "", nil, 0, 25 * time.Second, false},
+		// the flag makes up for it
+		{"lots", "", []string{"-streaks", "3"}, 3, 25 * time.Second, true},
+		{"", "a while", nil, 0, 25 * time.Second, false},
+		{"", "a while", []string{"-shutdown-timeout", "1m"}, 0, time.Minute, true},
+	}
+	for _, test := range tests {
+		os.Setenv("TILLY_SUMMARY_STREAKS", test.streaks)
+		os.Setenv("TILLY_SHUTDOWN_TIMEOUT", test.timeout)
+
+		opts := new(options)
+		fs := opts.flagSet("run")
+		opts.standupFlags(fs)
+		if err := fs.Parse(test.args); err != nil {
+			t.Fatal(err)
+		}
+		err := opts.envError()
+		if (err == nil) != test.ok || opts.streaks != test.wantStreaks || opts.shutdownTimeout != test.wantTimeout {
+			t.Errorf("%q, %q and %q: got %d, %s and %v", test.streaks, test.timeout, test.args,
+				opts.streaks, opts.shutdownTimeout, err)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/abourget/slack"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+const DefaultConfigFile = "tilly.json"
+
+/* Config is read from a JSON file, TILLY_CONFIG or tilly.json in the working
+ * directory. Everything in it is optional; with no file at all, Tilly behaves
+ * just as she always has.
+ */
+type Config struct {
+	// Facilitators may control stand-ups by DM, like workspace admins.
+	// Either user ids or user names.
+	Facilitators []string `json:"facilitators"`
+	// Defaults apply to every channel; Channels, keyed by channel name or
+	// id, override them field by field.
+	Defaults json.RawMessage            `json:"defaults"`
+	Channels map[string]json.RawMessage `json:"channels"`
+	// iCalendar files or URLs. Nobody's asked to stand-ups on days in the
+	// holiday calendars, and people are away during events in their own
+	// leave calendars, keyed by user id or name.
+	HolidayCalendars []string            `json:"holiday_calendars"`
+	LeaveCalendars   map[string][]string `json:"leave_calendars"`
+	// Locales add to or change the languages we speak, keyed by locale; see
+	// locales.go.
+	Locales map[string]Catalogue `json:"locales"`
+}
+
+const (
+	startModeNow   = "now"
+	startModeLocal = "local"
+)
+
+const (
+	guestsInclude = "include"
+	guestsExclude = "exclude"
+)
+
+const (
+	layoutText        = "text"
+	layoutAttachments = "attachments"
+)
+
+type ChannelConfig struct {
+	// StartMode is "now" to ask everyone as soon as the stand-up starts,
+	// or "local" to ask each person at LocalStartTime in their own timezone.
+	StartMode      string `json:"start_mode"`
+	LocalStartTime string `json:"local_start_time"`
+	// WaitForPresence holds off asking anyone Slack says is away until they
+	// come back, though never past the deadline.
+	WaitForPresence bool `json:"wait_for_presence"`
+	// Guests is "include" to ask workspace guests like anyone else, or
+	// "exclude" to leave them out.
+	Guests string `json:"guests"`
+	// If Allow is set, only the people in it are asked, and nobody in Deny
+	// ever is. Both list user ids or names, or user groups by id or handle.
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+	// Roster, if set, is who's asked instead of everyone in the channel:
+	// user ids or names, or user groups by id or handle. The summary still
+	// goes in the channel.
+	Roster []string `json:"roster"`
+	// Templates override what we say, by name, and Nags replace our
+	// reminders; see templates.go.
+	Templates map[string]string `json:"templates"`
+	Nags      []string          `json:"nags"`
+	// Locale is the language of the summary, and of the questions for
+	// anyone who hasn't chosen their own.
+	Locale string `json:"locale"`
+	// Layout is "text" for a summary that's one message, or "attachments"
+	// for an attachment for each person who answered.
+	Layout string `json:"layout"`
+	// Order is how people are ordered in the summary: "name", "completed",
+	// "channel" or "status"; see order.go.
+	Order string `json:"order"`
+	// ShowTimes puts how long each person took to finish in the summary.
+	ShowTimes bool `json:"show_times"`
+	// NagMinutesBeforeEnd is when to remind people who haven't finished,
+	// in minutes before their deadline.
+	NagMinutesBeforeEnd []int `json:"nag_minutes_before_end"`
+}
+
+var Settings = new(Config)
+
+func LoadConfig(path string) (config *Config, err error) {
+	config = new(Config)
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && path == DefaultConfigFile {
+		return config, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+	if err = config.validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (self *Config) validate() error {
+	for locale := range self.Locales {
+		if _, err := self.Templates(ChannelConfig{}, locale); err != nil {
+			return fmt.Errorf("locale %s: %s", locale, err)
+		}
+		if _, err := self.Replies(locale); err != nil {
+			return fmt.Errorf("locale %s: %s", locale, err)
+		}
+	}
+	if _, err := self.channel(nil); err != nil {
+		return fmt.Errorf("defaults: %s", err)
+	}
+	for name, raw := range self.Channels {
+		if _, err := self.channel(raw); err != nil {
+			return fmt.Errorf("channel %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// Channel returns the settings for a channel, overlaying anything set for it
+// specifically on top of the defaults.
+func (self *Config) Channel(ch slack.Channel) ChannelConfig {
+	raw, ok := self.Channels[ch.Id]
+	if !ok {
+		raw = self.Channels[ch.Name]
+	}
+	// we validated everything on loading
+	cc, _ := self.channel(raw)
+	return cc
+}
+
+func (self *Config) channel(raw json.RawMessage) (cc ChannelConfig, err error) {
+	cc.StartMode = startModeNow
+	cc.Guests = guestsInclude
+	cc.Locale = defaultLocale
+	cc.Layout = layoutText
+	cc.Order = orderName
+	// a copy, since unmarshalling would reuse the array
+	cc.NagMinutesBeforeEnd = append([]int(nil), StandupNagMinutesBeforeEnd...)
+	if len(self.Defaults) > 0 {
+		if err = json.Unmarshal(self.Defaults, &cc); err != nil {
+			return
+		}
+	}
+	if len(raw) > 0 {
+		if err = json.Unmarshal(raw, &cc); err != nil {
+			return
+		}
+	}
+	if err = cc.validate(); err != nil {
+		return
+	}
+	_, err = self.Templates(cc, cc.Locale)
+	return
+}
+
+func (self ChannelConfig) validate() error {
+	switch self.StartMode {
+	case startModeNow:
+	case startModeLocal:
+		if _, err := time.Parse(localTimeFormat, self.LocalStartTime); err != nil {
+			return fmt.Errorf("local_start_time must be like 09:30: %s", err)
+		}
+	default:
+		return fmt.Errorf("unknown start_mode %s", self.StartMode)
+	}
+	if self.Guests != guestsInclude && self.Guests != guestsExclude {
+		return fmt.Errorf("guests must be include or exclude, not %s", self.Guests)
+	}
+	if self.Layout != layoutText && self.Layout != layoutAttachments {
+		return fmt.Errorf("layout must be text or attachments, not %s", self.Layout)
+	}
+	switch self.Order {
+	case orderName, orderCompleted, orderChannel, orderStatus:
+	default:
+		return fmt.Errorf("order must be name, completed, channel or status, not %s", self.Order)
+	}
+	for _, m := range self.NagMinutesBeforeEnd {
+		if m <= 0 {
+			return fmt.Errorf("nag_minutes_before_end must be more than zero, not %d", m)
+		}
+	}
+	return nil
+}
+
+/* Excludes says whether to leave someone out of the channel's stand-ups, and
+ * why, for the summary. Deactivated accounts are always left out. groups are
+ * only needed if the channel has an allow or deny list.
+ */
+func (self ChannelConfig) Excludes(user slack.User, groups []userGroup) (reason string, excluded bool) {
+	switch {
+	case user.Deleted:
+		return "their account is deactivated", true
+	case listIncludes(self.Deny, user, groups):
+		return "they're on the channel's deny list", true
+	case len(self.Allow) > 0:
+		// being allowed explicitly trumps being a guest
+		if !listIncludes(self.Allow, user, groups) {
+			return "they're not on the channel's allow list", true
+		}
+	case self.Guests == guestsExclude && (user.IsRestricted || user.IsUltraRestricted):
+		return "guests aren't asked in this channel", true
+	}
+	return "", false
+}
+
+// Members returns who the channel's stand-ups are for: its roster, or
+// everyone in it.
+func (self ChannelConfig) Members(ch slack.Channel, directory *UserDirectory) []string {
+	if len(self.Roster) == 0 {
+		return ch.Members
+	}
+	return directory.Resolve(self.Roster)
+}
+
+func (self ChannelConfig) NeedsUserGroups() bool {
+	return len(self.Allow) > 0 || len(self.Deny) > 0
+}
+
+func listIncludes(list []string, user slack.User, groups []userGroup) bool {
+	for _, entry := range list {
+		entry = strings.TrimPrefix(entry, "@")
+		if entry == user.Id || entry == user.Name {
+			return true
+		}
+		for _, g := range groups {
+			if entry == g.Id || entry == g.Handle {
+				for _, userId := range g.Users {
+					if userId == user.Id {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (self *Config) IsFacilitator(user slack.User) bool {
+	for _, f := range self.Facilitators {
+		if f == user.Id || f == user.Name || f == "@"+user.Name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/abourget/slack"
+	"testing"
+)
+
+func TestChannelConfigMembers(t *testing.T) {
+	source := newFakeUserSource(
+		slack.User{Id: "U1", Name: "bob"},
+		slack.User{Id: "U2", Name: "amy"},
+		slack.User{Id: "U3", Name: "cat"})
+	source.groups = []userGroup{{Id: "S1", Handle: "backend-squad", Users: []string{"U3", "U2"}}}
+	directory := NewUserDirectory(source)
+	ch := testChannel("C1", "design", "U1", "U9")
+
+	tests := []struct {
+		roster []string
+		want   []string
+	}{
+		{nil, []string{"U1", "U9"}},
+		{[]string{"@backend-squad"}, []string{"U3", "U2"}},
+		{[]string{"bob", "@backend-squad", "U2"}, []string{"U1", "U3", "U2"}},
+	}
+	for _, test := range tests {
+		cc := ChannelConfig{Roster: test.roster}
+		if got := cc.Members(ch, directory); !equalStrings(got, test.want) {
+			t.Errorf("Members with roster %q = %q; want %q", test.roster, got, test.want)
+		}
+	}
+}
+
+func TestChannelConfigExcludes(t *testing.T) {
+	groups := []userGroup{{Id: "S1", Handle: "stakeholders", Users: []string{"U2"}}}
+	bob := slack.User{Id: "U1", Name: "bob"}
+	amy := slack.User{Id: "U2", Name: "amy"}
+	guest := slack.User{Id: "U3", Name: "cat", IsRestricted: true}
+	gone := slack.User{Id: "U4", Name: "dan", Deleted: true}
+
+	tests := []struct {
+		cc       ChannelConfig
+		user     slack.User
+		excluded bool
+	}{
+		{ChannelConfig{}, bob, false},
+		{ChannelConfig{}, gone, true},
+		{ChannelConfig{Deny: []string{"@stakeholders"}}, amy, true},
+		{ChannelConfig{Deny: []string{"@stakeholders"}}, bob, false},
+		{ChannelConfig{Allow: []string{"bob"}}, amy, true},
+		{ChannelConfig{Allow: []string{"U1"}}, bob, false},
+		{ChannelConfig{Guests: guestsExclude}, guest, true},
+		// being allowed trumps being a guest
+		{ChannelConfig{Guests: guestsExclude, Allow: []string{"cat"}}, guest, false},
+		{ChannelConfig{Allow: []string{"cat"}, Deny: []string{"U3"}}, guest, true},
+	}
+	for _, test := range tests {
+		if reason, excluded := test.cc.Excludes(test.user, groups); excluded != test.excluded {
+			t.Errorf("%+v excludes %s: %t (%s); want %t", test.cc, test.user.Name, excluded, reason, test.excluded)
+		}
+	}
+}
+
+func TestRosterStandup(t *testing.T) {
+	defer func(settings *Config) { Settings = settings }(Settings)
+	Settings = &Config{Channels: map[string]json.RawMessage{
+		"design": json.RawMessage(`{"roster": ["@backend-squad", "amy"]}`),
+	}}
+
+	b := newTestBot(t,
+		slack.User{Id: "U1", Name: "bob"},
+		slack.User{Id: "U2", Name: "amy"},
+		slack.User{Id: "U3", Name: "cat"})
+	defer b.Close()
+	b.slack.groups = []map[string]interface{}{{"id": "S1", "handle": "backend-squad", "users": []string{"U3"}}}
+
+	// bob's a stakeholder in the channel; cat's in the squad, but not the
+	// channel
+	s := b.start(t, testChannel("C1", "design", "U1", "U2"), "U2", "U3")
+	s.End()
+	b.waitReported(t)
+
+	if dms := b.slack.DMs("U1"); len(dms) > 0 {
+		t.Errorf("bob was asked, though he's not on the roster: %q", dms)
+	}
+	if posts := b.slack.ChannelPosts("C1"); len(posts) == 0 {
+		t.Error("no summary in the channel")
+	}
+}
+
+func TestPolicyStandup(t *testing.T) {
+	defer func(settings *Config) { Settings = settings }(Settings)
+	Settings = &Config{Channels: map[string]json.RawMessage{
+		"design": json.RawMessage(`{"guests": "exclude", "deny": ["dan"]}`),
+	}}
+
+	b := newTestBot(t,
+		slack.User{Id: "U1", Name: "bob"},
+		slack.User{Id: "U2", Name: "cat", IsRestricted: true},
+		slack.User{Id: "U3", Name: "dan"},
+		slack.User{Id: "U4", Name: "eve", Deleted: true})
+	defer b.Close()
+
+	s := b.start(t, testChannel("C1", "design", "U1", "U2", "U3", "U4"), "U1")
+	s.End()
+	b.waitReported(t)
+
+	for _, userId := range []string{"U2", "U3", "U4"} {
+		if dms := b.slack.DMs(userId); len(dms) > 0 {
+			t.Errorf("%s was asked, though the policy leaves them out: %q", userId, dms)
+		}
+	}
+	want := map[string]string{
+		"U2": "guests aren't asked in this channel",
+		"U3": "they're on the channel's deny list",
+		"U4": "their account is deactivated",
+	}
+	for _, p := range s.record().Participants {
+		if reason, ok := want[p.UserId]; ok && (p.Status != participantExcluded || p.Reason != reason) {
+			t.Errorf("%s %s (%s); want excluded because %s", p.UserId, p.Status, p.Reason, reason)
+		}
+	}
+}
+
+func TestGuestsValidated(t *testing.T) {
+	config := &Config{Defaults: json.RawMessage(`{"guests": "sometimes"}`)}
+	if err := config.validate(); err == nil {
+		t.Error("validated guests sometimes; want an error")
+	}
+}
@@ -0,0 +1,529 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/abourget/slack"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const dashboardCookieName = "tilly_session"
+
+/* Dashboard serves a read-only view of the stand-up history. It has no
+ * external assets and no database; every page is built from the history
+ * file on each request.
+ *
+ * Access is gated by a shared secret, entered once on the sign-in page and
+ * remembered in a cookie. It's a stand-in for proper Sign in with Slack,
+ * which would need an OAuth app and a public callback URL.
+ */
+type Dashboard struct {
+	history *History
+	secret  string
+	mux     *http.ServeMux
+}
+
+type dashboardChannel struct {
+	Id       string
+	Name     string
+	Standups int
+	Last     time.Time
+	Rate     float64
+}
+
+type dashboardPerson struct {
+	Id       string
+	Name     string
+	RealName string
+	Asked    int
+	Rate     float64
+}
+
+type dashboardEntry struct {
+	Standup     StandupRecord
+	Participant ParticipantRecord
+}
+
+type dashboardHit struct {
+	Standup  StandupRecord
+	UserId   string
+	Name     string
+	Question string
+	Answer   string
+}
+
+func NewDashboard(history *History, secret string) (d *Dashboard) {
+	d = &Dashboard{
+		history: history,
+		secret:  secret,
+		mux:     http.NewServeMux(),
+	}
+	d.mux.HandleFunc("/login", d.login)
+	d.mux.HandleFunc("/logout", d.logout)
+	d.mux.HandleFunc("/", d.authorised(d.index))
+	d.mux.HandleFunc("/channels/", d.authorised(d.channel))
+	d.mux.HandleFunc("/standups/", d.authorised(d.standup))
+	d.mux.HandleFunc("/people/", d.authorised(d.person))
+	d.mux.HandleFunc("/search", d.authorised(d.search))
+	return
+}
+
+func (self *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	self.mux.ServeHTTP(w, r)
+}
+
+func (self *Dashboard) sessionToken() string {
+	mac := hmac.New(sha256.New, []byte(self.secret))
+	mac.Write([]byte("tilly dashboard session"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (self *Dashboard) authorised(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, err := r.Cookie(dashboardCookieName)
+		if err != nil || !hmac.Equal([]byte(c.Value), []byte(self.sessionToken())) {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (self *Dashboard) login(w http.ResponseWriter, r *http.Request) {
+	failed := false
+	if r.Method == "POST" {
+		given := r.PostFormValue("secret")
+		if hmac.Equal([]byte(given), []byte(self.secret)) {
+			http.SetCookie(w, &http.Cookie{
+				Name:     dashboardCookieName,
+				Value:    self.sessionToken(),
+				Path:     "/",
+				HttpOnly: true,
+			})
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		failed = true
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	self.render(w, "login", map[string]interface{}{"Failed": failed})
+}
+
+func (self *Dashboard) logout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:   dashboardCookieName,
+		Value:  "",
+		Path:   "/",
+		MaxAge: -1,
+	})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+func (self *Dashboard) records(w http.ResponseWriter) ([]StandupRecord, bool) {
+	records, err := self.history.Load()
+	if err != nil {
+		Log.Errorf("error loading history for dashboard: %s", err)
+		http.Error(w, "Couldn't load stand-up history", http.StatusInternalServerError)
+		return nil, false
+	}
+	return records, true
+}
+
+// channel is enough of the stand-up's channel to look up its settings by.
+func (rec StandupRecord) channel() slack.Channel {
+	ch := slack.Channel{Name: rec.ChannelName}
+	ch.Id = rec.ChannelId
+	return ch
+}
+
+func (self *Dashboard) index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	records, ok := self.records(w)
+	if !ok {
+		return
+	}
+
+	channelsById := make(map[string]*dashboardChannel)
+	responded := make(map[string]int)
+	asked := make(map[string]int)
+	peopleById := make(map[string]*dashboardPerson)
+	personResponded := make(map[string]int)
+
+	for _, rec := range records {
+		ch, ok := channelsById[rec.ChannelId]
+		if !ok {
+			ch = &dashboardChannel{Id: rec.ChannelId}
+			channelsById[rec.ChannelId] = ch
+		}
+		ch.Name = rec.ChannelName
+		ch.Standups++
+		ch.Last = rec.Started
+
+		for _, p := range rec.Participants {
+			if !p.Asked() {
+				continue
+			}
+			asked[rec.ChannelId]++
+			person, ok := peopleById[p.UserId]
+			if !ok {
+				person = &dashboardPerson{Id: p.UserId}
+				peopleById[p.UserId] = person
+			}
+			person.Name, person.RealName = p.Name, p.RealName
+			person.Asked++
+			if p.Responded() {
+				responded[rec.ChannelId]++
+				personResponded[p.UserId]++
+			}
+		}
+	}
+
+	channels := make([]*dashboardChannel, 0, len(channelsById))
+	for id, ch := range channelsById {
+		ch.Rate = rate(responded[id], asked[id])
+		channels = append(channels, ch)
+	}
+	sort.Sort(dashboardChannelsByName(channels))
+
+	people := make([]*dashboardPerson, 0, len(peopleById))
+	for id, person := range peopleById {
+		person.Rate = rate(personResponded[id], person.Asked)
+		people = append(people, person)
+	}
+	sort.Sort(dashboardPeopleByName(people))
+
+	self.render(w, "index", map[string]interface{}{
+		"Channels": channels,
+		"People":   people,
+	})
+}
+
+func (self *Dashboard) channel(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/channels/")
+	records, ok := self.records(w)
+	if !ok {
+		return
+	}
+
+	var name string
+	standups := make([]StandupRecord, 0)
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].ChannelId == id {
+			name = records[i].ChannelName
+			standups = append(standups, records[i])
+		}
+	}
+	if len(standups) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	// how many finish before each reminder and the deadline, to tune them by
+	var checkpoints []int
+	for _, m := range Settings.Channel(standups[0].channel()).NagMinutesBeforeEnd {
+		if m < StandupTimeMinutes {
+			checkpoints = append(checkpoints, StandupTimeMinutes-m)
+		}
+	}
+	sort.Ints(checkpoints)
+	checkpoints = append(checkpoints, StandupTimeMinutes)
+	self.render(w, "channel", map[string]interface{}{
+		"Name":        name,
+		"Standups":    standups,
+		"Stats":       ChannelStats(records, id),
+		"Questions":   standups[0].Questions,
+		"Checkpoints": checkpoints,
+	})
+}
+
+func (self *Dashboard) standup(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/standups/")
+	records, ok := self.records(w)
+	if !ok {
+		return
+	}
+
+	for _, rec := range records {
+		if rec.Id == id {
+			self.render(w, "standup", rec)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func (self *Dashboard) person(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/people/")
+	records, ok := self.records(w)
+	if !ok {
+		return
+	}
+
+	var entries []dashboardEntry
+	for i := len(records) - 1; i >= 0; i-- {
+		for _, p := range records[i].Participants {
+			if p.UserId == id {
+				entries = append(entries, dashboardEntry{Standup: records[i], Participant: p})
+			}
+		}
+	}
+	if len(entries) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	name, realName := id, ""
+	for _, e := range entries {
+		if e.Participant.Name != "" {
+			name, realName = e.Participant.Name, e.Participant.RealName
+			break
+		}
+	}
+
+	self.render(w, "person", map[string]interface{}{
+		"Name":     name,
+		"RealName": realName,
+		"Entries":  entries,
+		"Stats":    UserStats(records, id),
+	})
+}
+
+func (self *Dashboard) search(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	terms := strings.Fields(strings.ToLower(query))
+
+	var hits []dashboardHit
+	if len(terms) > 0 {
+		records, ok := self.records(w)
+		if !ok {
+			return
+		}
+		for i := len(records) - 1; i >= 0; i-- {
+			rec := records[i]
+			for _, p := range rec.Participants {
+				for qidx, a := range p.Answers {
+					if !matchesAllTerms(a, terms) {
+						continue
+					}
+					hit := dashboardHit{Standup: rec, UserId: p.UserId, Name: p.Name, Answer: a}
+					if qidx < len(rec.Questions) {
+						hit.Question = rec.Questions[qidx]
+					}
+					hits = append(hits, hit)
+				}
+			}
+		}
+	}
+
+	self.render(w, "search", map[string]interface{}{
+		"Query": query,
+		"Hits":  hits,
+	})
+}
+
+func (self *Dashboard) render(w http.ResponseWriter, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplates.ExecuteTemplate(w, name, data); err != nil {
+		Log.Errorf("error rendering dashboard page %s: %s", name, err)
+	}
+}
+
+func matchesAllTerms(text string, terms []string) bool {
+	text = strings.ToLower(text)
+	for _, t := range terms {
+		if !strings.Contains(text, t) {
+			return false
+		}
+	}
+	return true
+}
+
+func rate(n, of int) float64 {
+	if of == 0 {
+		return 0
+	}
+	return float64(n) / float64(of)
+}
+
+type dashboardChannelsByName []*dashboardChannel
+
+func (cs dashboardChannelsByName) Len() int           { return len(cs) }
+func (cs dashboardChannelsByName) Less(i, j int) bool { return cs[i].Name < cs[j].Name }
+func (cs dashboardChannelsByName) Swap(i, j int)      { cs[i], cs[j] = cs[j], cs[i] }
+
+type dashboardPeopleByName []*dashboardPerson
+
+func (ps dashboardPeopleByName) Len() int           { return len(ps) }
+func (ps dashboardPeopleByName) Less(i, j int) bool { return ps[i].Name < ps[j].Name }
+func (ps dashboardPeopleByName) Swap(i, j int)      { ps[i], ps[j] = ps[j], ps[i] }
+
+var dashboardTemplates = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"date": func(t time.Time) string {
+		return t.Format("Mon 2 Jan 2006")
+	},
+	"time": func(t time.Time) string {
+		return t.Format("15:04")
+	},
+	"percent": func(f float64) string {
+		return fmt.Sprintf("%.0f%%", f*100)
+	},
+	"duration": func(d time.Duration) string {
+		return roundDuration(d).String()
+	},
+	"within": func(s ParticipationStats, minutes int) float64 {
+		return s.CompletedWithin(time.Duration(minutes) * time.Minute)
+	},
+	"latency": func(rec StandupRecord, p ParticipantRecord, i int) time.Duration {
+		latency, _ := p.Latency(rec, i)
+		return latency
+	},
+	"question": func(qs []string, i int) string {
+		if i < len(qs) {
+			return qs[i]
+		}
+		return ""
+	},
+	"asked": func(ps []ParticipantRecord) (n int) {
+		for _, p := range ps {
+			if p.Asked() {
+				n++
+			}
+		}
+		return
+	},
+	"responded": func(ps []ParticipantRecord) (n int) {
+		for _, p := range ps {
+			if p.Responded() {
+				n++
+			}
+		}
+		return
+	},
+}).Parse(dashboardTemplateText))
+
+const dashboardTemplateText = `
+{{define "header"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.}} · Tilly</title>
+<style>
+body { font: 15px/1.5 -apple-system, "Helvetica Neue", Helvetica, Arial, sans-serif; color: #2c2d30; max-width: 60em; margin: 0 auto; padding: 1em 2em; }
+header { display: flex; align-items: center; justify-content: space-between; border-bottom: 1px solid #ddd; margin-bottom: 1em; }
+header a { color: inherit; text-decoration: none; }
+a { color: #1264a3; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: .3em .6em; border-bottom: 1px solid #eee; vertical-align: top; }
+ul.answers { margin: .2em 0 1em; }
+.status { font-size: .85em; padding: .1em .5em; border-radius: 1em; background: #eee; }
+.status-answered { background: #d6f5d6; }
+.status-partial { background: #fff2c4; }
+.status-skipped { background: #e4e4f7; }
+.status-absent, .status-error { background: #f7d4d4; }
+.muted { color: #888; }
+form.search input[type=search] { width: 18em; }
+</style>
+</head>
+<body>
+<header>
+<h1><a href="/">Tilly</a></h1>
+<form class="search" action="/search"><input type="search" name="q" placeholder="Search answers"> <a href="/logout">Sign out</a></form>
+</header>
+{{end}}
+
+{{define "footer"}}</body>
+</html>
+{{end}}
+
+{{define "login"}}<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>Sign in · Tilly</title>
+<style>body { font: 15px/1.5 -apple-system, "Helvetica Neue", Helvetica, Arial, sans-serif; max-width: 24em; margin: 4em auto; }</style>
+</head>
+<body>
+<h1>Tilly</h1>
+{{if .Failed}}<p>That's not the right secret.</p>{{end}}
+<form method="post" action="/login">
+<p><label>Dashboard secret<br><input type="password" name="secret" autofocus></label></p>
+<p><button type="submit">Sign in</button></p>
+</form>
+</body>
+</html>
+{{end}}
+
+{{define "index"}}{{template "header" "Stand-ups"}}
+<h2>Channels</h2>
+{{if .Channels}}<table>
+<tr><th>Channel</th><th>Stand-ups</th><th>Last</th><th>Participation</th></tr>
+{{range .Channels}}<tr><td><a href="/channels/{{.Id}}">#{{.Name}}</a></td><td>{{.Standups}}</td><td>{{date .Last}}</td><td>{{percent .Rate}}</td></tr>
+{{end}}</table>{{else}}<p class="muted">No stand-ups recorded yet.</p>{{end}}
+<h2>People</h2>
+{{if .People}}<table>
+<tr><th>Person</th><th>Asked</th><th>Participation</th></tr>
+{{range .People}}<tr><td><a href="/people/{{.Id}}">@{{.Name}}</a> <span class="muted">{{.RealName}}</span></td><td>{{.Asked}}</td><td>{{percent .Rate}}</td></tr>
+{{end}}</table>{{end}}
+{{template "footer"}}{{end}}
+
+{{define "channel"}}{{template "header" .Name}}
+<h2>#{{.Name}}</h2>
+<p>{{percent .Stats.ResponseRate}} of people asked took part.
+{{with .Stats.AverageTimeToComplete}}People take {{duration .}} to finish on average.{{end}}</p>
+{{if .Stats.AverageTimeToComplete}}<p>Of those who finish, {{range $i, $m := .Checkpoints}}{{if $i}}, {{end}}{{percent (within $.Stats $m)}} do within {{$m}} minutes{{end}}.</p>{{end}}
+{{with .Stats.AverageLatencies}}<h3>Time to answer</h3>
+<table>
+<tr><th>Question</th><th>Average</th></tr>
+{{range $i, $d := .}}{{if $d}}<tr><td>{{question $.Questions $i}}</td><td>{{duration $d}}</td></tr>
+{{end}}{{end}}</table>{{end}}
+<h3>Stand-ups</h3>
+<table>
+<tr><th>Date</th><th>Started</th><th>Responded</th></tr>
+{{range .Standups}}<tr><td><a href="/standups/{{.Id}}">{{date .Started}}</a></td><td>{{time .Started}}</td><td>{{responded .Participants}} of {{asked .Participants}}</td></tr>
+{{end}}</table>
+{{template "footer"}}{{end}}
+
+{{define "standup"}}{{template "header" .ChannelName}}
+<h2><a href="/channels/{{.ChannelId}}">#{{.ChannelName}}</a>, {{date .Started}}</h2>
+<p class="muted">Started {{time .Started}}, finished {{time .Finished}}{{if .Interrupted}}, interrupted when I shut down{{end}}.</p>
+<h3>Questions</h3>
+<ol>{{range .Questions}}<li>{{.}}</li>{{end}}</ol>
+<h3>Replies</h3>
+{{$questions := .Questions}}
+{{$rec := .}}
+{{range $p := .Participants}}
+<p><a href="/people/{{.UserId}}">@{{or .Name .UserId}}</a> <span class="status status-{{.Status}}">{{.Status}}</span>{{with .Reason}} <span class="muted">{{.}}</span>{{end}}</p>
+{{if .Answers}}<ul class="answers">{{range $i, $a := .Answers}}{{if $a}}<li><span class="muted">{{question $questions $i}}{{with latency $rec $p $i}} · {{duration .}}{{end}}</span><br>{{$a}}</li>{{end}}{{end}}</ul>{{end}}
+{{end}}
+{{template "footer"}}{{end}}
+
+{{define "person"}}{{template "header" .Name}}
+<h2>@{{.Name}} <span class="muted">{{.RealName}}</span></h2>
+<p>Took part in {{percent .Stats.ResponseRate}} of the {{.Stats.Asked}} stand-ups they were asked to.
+{{with .Stats.AverageTimeToComplete}}Takes {{duration .}} to finish on average.{{end}}
+Current streak {{.Stats.Streak}} days, best {{.Stats.LongestStreak}}.</p>
+{{range .Entries}}
+<h3><a href="/standups/{{.Standup.Id}}">{{date .Standup.Started}}</a> in <a href="/channels/{{.Standup.ChannelId}}">#{{.Standup.ChannelName}}</a> <span class="status status-{{.Participant.Status}}">{{.Participant.Status}}</span></h3>
+{{$questions := .Standup.Questions}}
+{{if .Participant.Answers}}<ul class="answers">{{range $i, $a := .Participant.Answers}}{{if $a}}<li><span class="muted">{{question $questions $i}}</span><br>{{$a}}</li>{{end}}{{end}}</ul>{{end}}
+{{end}}
+{{template "footer"}}{{end}}
+
+{{define "search"}}{{template "header" "Search"}}
+<h2>Search</h2>
+<form action="/search"><input type="search" name="q" value="{{.Query}}" autofocus> <button type="submit">Search</button></form>
+{{if .Query}}<p class="muted">{{len .Hits}} matching answers.</p>{{end}}
+{{range .Hits}}
+<p><a href="/people/{{.UserId}}">@{{.Name}}</a> in <a href="/standups/{{.Standup.Id}}">#{{.Standup.ChannelName}}, {{date .Standup.Started}}</a><br>
+<span class="muted">{{.Question}}</span><br>{{.Answer}}</p>
+{{end}}
+{{template "footer"}}{{end}}
+`
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func dashboardGet(t *testing.T, d *Dashboard, path string) string {
+	req := httptest.NewRequest("GET", path, nil)
+	req.AddCookie(&http.Cookie{Name: dashboardCookieName, Value: d.sessionToken()})
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s: %d", path, w.Code)
+	}
+	return w.Body.String()
+}
+
+func TestDashboardNeedsSignIn(t *testing.T) {
+	history, cleanUp := tempHistory(t)
+	defer cleanUp()
+
+	w := httptest.NewRecorder()
+	NewDashboard(history, "sekrit").ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/login" {
+		t.Errorf("got %d to %s; want a redirect to /login", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestDashboardPersonCountsStandupsTheyWereAskedTo(t *testing.T) {
+	history, cleanUp := tempHistory(t)
+	defer cleanUp()
+
+	started := time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)
+	for i, status := range []string{participantAnswered, participantOnLeave, participantAbsent, participantExcluded} {
+		history.Append(StandupRecord{
+			Id:        "C1-" + status,
+			ChannelId: "C1",
+			Started:   started.AddDate(0, 0, i),
+			Participants: []ParticipantRecord{
+				{UserId: "U1", Name: "bob", Status: status},
+			},
+		})
+	}
+
+	page := dashboardGet(t, NewDashboard(history, "sekrit"), "/people/U1")
+	if !strings.Contains(page, "50% of the 2 stand-ups") {
+		t.Errorf("the person page should count the 2 stand-ups bob was asked to:\n%s", page)
+	}
+}
+
+func TestDashboardCheckpointsFollowChannelNags(t *testing.T) {
+	history, cleanUp := tempHistory(t)
+	defer cleanUp()
+
+	defer func(settings *Config) { Settings = settings }(Settings)
+	Settings = &Config{Channels: map[string]json.RawMessage{
+		"design": json.RawMessage(`{"nag_minutes_before_end": [5, 20, 45]}`),
+	}}
+
+	started := time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)
+	completed := started.Add(7 * time.Minute)
+	history.Append(StandupRecord{
+		Id:          "C1-1",
+		ChannelId:   "C1",
+		ChannelName: "design",
+		Started:     started,
+		Participants: []ParticipantRecord{
+			{UserId: "U1", Name: "bob", Status: participantAnswered, Completed: &completed},
+		},
+	})
+
+	page := dashboardGet(t, NewDashboard(history, "sekrit"), "/channels/C1")
+	want := "100% do within 10 minutes, 100% do within 25 minutes, 100% do within 30 minutes."
+	if !strings.Contains(page, want) {
+		t.Errorf("want %q, leaving out the nag before the stand-up starts:\n%s", want, page)
+	}
+}
+
+func TestDashboardChannelWithoutLatencies(t *testing.T) {
+	history, cleanUp := tempHistory(t)
+	defer cleanUp()
+
+	// from before we kept when people answered
+	started := time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)
+	history.Append(StandupRecord{
+		Id:          "C1-1",
+		ChannelId:   "C1",
+		ChannelName: "design",
+		Started:     started,
+		Participants: []ParticipantRecord{
+			{UserId: "U1", Name: "bob", Status: participantAnswered},
+		},
+	})
+
+	page := dashboardGet(t, NewDashboard(history, "sekrit"), "/channels/C1")
+	if strings.Contains(page, "Time to answer") || !strings.Contains(page, "<h3>Stand-ups</h3>") ||
+		!strings.Contains(page, `<a href="/standups/C1-1">`) {
+		t.Errorf("want the stand-ups, headed, and no times to answer:\n%s", page)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"github.com/abourget/slack"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* A dry run goes through the motions of starting stand-ups without sending
+ * anything, so you can see who'd be asked what before they are. It only
+ * reads from Slack: we don't even open DMs.
+ */
+type channelPlan struct {
+	channel slack.Channel
+	// a stand-up that never runs, just to render the summary
+	standup   *Standup
+	asking    []string
+	notAsking []string
+}
+
+func dryRun(client *AuthedSlack, preferences *Preferences, calendars *Calendars, chs []slack.Channel, out io.Writer) error {
+	if len(chs) == 0 {
+		fmt.Fprintln(out, "I'm not in any channels, so no stand-ups would run.")
+		return nil
+	}
+
+	directory := NewUserDirectory(client)
+	for _, ch := range chs {
+		plan, err := planChannel(client, directory, preferences, calendars, ch, time.Now())
+		if err != nil {
+			return err
+		}
+		plan.describe(out)
+	}
+	return nil
+}
+
+// listChannels is a dry run in brief: just who'd be asked where.
+func listChannels(client *AuthedSlack, preferences *Preferences, calendars *Calendars, chs []slack.Channel, out io.Writer) error {
+	if len(chs) == 0 {
+		fmt.Fprintln(out, "I'm not in any channels.")
+		return nil
+	}
+
+	directory := NewUserDirectory(client)
+	for _, ch := range chs {
+		plan, err := planChannel(client, directory, preferences, calendars, ch, time.Now())
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "#%s: %s\n", ch.Name, strings.Join(plan.asking, ", "))
+		for _, name := range plan.notAsking {
+			fmt.Fprintf(out, "  not %s\n", name)
+		}
+	}
+	return nil
+}
+
+func planChannel(client *AuthedSlack, directory *UserDirectory, preferences *Preferences, calendars *Calendars, ch slack.Channel, now time.Time) (*channelPlan, error) {
+	s := NewStandup(client, ch, nil, nil, new(sync.WaitGroup))
+	plan := &channelPlan{channel: ch, standup: s}
+	if s.config.NeedsUserGroups() {
+		s.userGroups = directory.UserGroups()
+	}
+
+	for _, userId := range s.config.Members(ch, directory) {
+		if userId == client.UserId {
+			continue
+		}
+		info, err := directory.Get(userId)
+		if err != nil {
+			return nil, err
+		}
+		name := fmt.Sprintf("@%s", info.Name)
+		if info.RealName != "" {
+			name = fmt.Sprintf("@%s (%s)", info.Name, info.RealName)
+		}
+
+		reason, excluded := s.config.Excludes(*info, s.userGroups)
+		start := s.startTimeFor(*info, now)
+
+		// the same checks as UserManager makes, in the same order
+		switch {
+		case info.IsBot:
+			plan.notAsking = append(plan.notAsking, name+": a bot")
+		case preferences != nil && preferences.Get(userId).OnLeave(ch.Id, start):
+			plan.notAsking = append(plan.notAsking, name+": on leave or opted out")
+			s.onLeave = append(s.onLeave, userId)
+		case excluded:
+			plan.notAsking = append(plan.notAsking, name+": "+reason)
+			s.excluded = append(s.excluded, userId)
+			s.exclusions[userId] = reason
+		case calendars.Away(*info, start):
+			plan.notAsking = append(plan.notAsking, name+": away, on leave or a holiday")
+			s.away = append(s.away, userId)
+		default:
+			if s.config.StartMode == startModeLocal {
+				name += fmt.Sprintf(", at %s (%s our time)",
+					start.Format("15:04 MST"), start.Local().Format("15:04"))
+			}
+			plan.asking = append(plan.asking, name)
+			s.userIds = append(s.userIds, userId)
+			s.userReplies[&User{info: *info}] = sampleAnswers(len(s.Questions))
+		}
+	}
+	return plan, nil
+}
+
+func (self *channelPlan) describe(out io.Writer) {
+	s := self.standup
+
+	fmt.Fprintf(out, "#%s\n", self.channel.Name)
+	if len(s.config.Roster) > 0 {
+		fmt.Fprintf(out, "  Using its roster: %s\n", strings.Join(s.config.Roster, ", "))
+	}
+	if len(self.asking) == 1 {
+		fmt.Fprint(out, "  Would DM 1 person")
+	} else {
+		fmt.Fprintf(out, "  Would DM %d people", len(self.asking))
+	}
+	if s.config.WaitForPresence {
+		fmt.Fprint(out, ", once they're active")
+	}
+	fmt.Fprintln(out, ":")
+	for _, name := range self.asking {
+		fmt.Fprintf(out, "    %s\n", name)
+	}
+	if len(self.notAsking) > 0 {
+		fmt.Fprintln(out, "  Wouldn't ask:")
+		for _, name := range self.notAsking {
+			fmt.Fprintf(out, "    %s\n", name)
+		}
+	}
+	fmt.Fprintln(out, "  They'd be asked:")
+	for _, q := range s.Questions {
+		fmt.Fprintf(out, "    • %s\n", q)
+	}
+	if s.config.Layout == layoutAttachments {
+		fmt.Fprintln(out, "  The summary would be laid out as attachments, but say this, if everyone answered:")
+	} else {
+		fmt.Fprintln(out, "  The summary would look like this, if everyone answered:")
+	}
+	for _, line := range strings.Split(strings.TrimRight(s.summary(true), "\n"), "\n") {
+		fmt.Fprintf(out, "    %s\n", line)
+	}
+	fmt.Fprintln(out)
+}
+
+func sampleAnswers(n int) userAnswersReply {
+	answers := make(userAnswersReply, n)
+	for i := range answers {
+		answers[i] = fmt.Sprintf("(answer %d)", i+1)
+	}
+	return answers
+}
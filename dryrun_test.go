@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/abourget/slack"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlanChannel(t *testing.T) {
+	defer func(settings *Config) { Settings = settings }(Settings)
+	Settings = &Config{Channels: map[string]json.RawMessage{
+		"design": json.RawMessage(`{"guests": "exclude", "wait_for_presence": true}`),
+	}}
+	dir, cleanUp := tempDir(t)
+	defer cleanUp()
+	prefs, err := LoadPreferences(filepath.Join(dir, "preferences.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefs.Update("U4", func(p *UserPreferences) { p.OptedOut = []string{"C1"} })
+	leave := testCalendar(t, "BEGIN:VEVENT\r\nSUMMARY:Off\r\nDTSTART;VALUE=DATE:20261021\r\nEND:VEVENT\r\n")
+	calendars := &Calendars{leave: map[string][]*Calendar{"peter": {leave}}}
+
+	directory := NewUserDirectory(newFakeUserSource(
+		slack.User{Id: "U1", Name: "amy", RealName: "Amy Pond", TZ: "Europe/London"},
+		slack.User{Id: "U2", Name: "bot", IsBot: true},
+		slack.User{Id: "U3", Name: "cat", IsRestricted: true},
+		slack.User{Id: "U4", Name: "dan"},
+		slack.User{Id: "U5", Name: "peter", TZ: "Europe/London"},
+	))
+	client := &AuthedSlack{UserId: "UTILLY"}
+	now := time.Date(2026, 10, 21, 9, 30, 0, 0, london)
+
+	plan, err := planChannel(client, directory, prefs, calendars,
+		testChannel("C1", "design", "U1", "UTILLY", "U2", "U3", "U4", "U5"), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(plan.asking, "; "), "@amy (Amy Pond)"; got != want {
+		t.Errorf("asking %q; want %q", got, want)
+	}
+	want := []string{
+		"@bot: a bot",
+		"@cat: guests aren't asked in this channel",
+		"@dan: on leave or opted out",
+		"@peter: away, on leave or a holiday",
+	}
+	if got := strings.Join(plan.notAsking, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("not asking:\n%s\nwant:\n%s", got, strings.Join(want, "\n"))
+	}
+
+	var out bytes.Buffer
+	plan.describe(&out)
+	for _, line := range []string{
+		"#design\n",
+		"  Would DM 1 person, once they're active:\n    @amy (Amy Pond)\n",
+		"  Wouldn't ask:\n    @bot: a bot\n",
+		"    • " + Questions[0] + "\n",
+		"(answer 1)",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("want %q in:\n%s", line, out.String())
+		}
+	}
+	// only amy's in the sample summary
+	if len(plan.standup.userReplies) != 1 {
+		t.Errorf("got %d people's sample answers; want amy's", len(plan.standup.userReplies))
+	}
+}
@@ -2,30 +2,134 @@ package main
 
 import (
 	"github.com/abourget/slack"
+	"strings"
+)
+
+// Slack tells us who's joined or left a channel with messages of these
+// subtypes, which it posts in the channel.
+const (
+	slackSubtypeChannelJoin  = "channel_join"
+	slackSubtypeChannelLeave = "channel_leave"
+	slackSubtypeGroupJoin    = "group_join"
+	slackSubtypeGroupLeave   = "group_leave"
 )
 
 type EventReceiver struct {
-	client      *slack.RTM
-	userManager *UserManager
-	botUserId   string
+	client          *slack.RTM
+	userManager     *UserManager
+	standups        *StandupManager
+	channelCommands *ChannelCommands
+	botUserId       string
+	stop            chan struct{}
 }
 
-func NewEventReceiver(client *slack.RTM, um *UserManager, botUserId string) (er *EventReceiver) {
+func NewEventReceiver(client *slack.RTM, um *UserManager, sm *StandupManager, cc *ChannelCommands, botUserId string) (er *EventReceiver) {
 	client.IncomingEvents = make(chan slack.SlackEvent)
 	return &EventReceiver{
-		client:      client,
-		userManager: um,
-		botUserId:   botUserId,
+		client:          client,
+		userManager:     um,
+		standups:        sm,
+		channelCommands: cc,
+		botUserId:       botUserId,
+		stop:            make(chan struct{}),
 	}
 }
 
 func (self *EventReceiver) Start() {
 	go self.client.ManageConnection()
-	DebugLog.Println("EventReceiver started")
-	for ev := range self.client.IncomingEvents {
-		if m, ok := ev.Data.(*slack.MessageEvent); ok && m.UserId != self.botUserId && m.Text != "" {
-			DebugLog.Printf("Received message id %s from RTM, userId '%s' : %s", m.Timestamp, m.UserId, m.Text)
-			self.userManager.ReceiveMessageReply(*m)
+	Log.Debugf("EventReceiver started")
+	for {
+		select {
+		case ev := <-self.client.IncomingEvents:
+			self.handle(ev)
+		case <-self.stop:
+			Log.Infof("stopped handling RTM events")
+			setRTMState("disconnected")
+			return
 		}
 	}
 }
+
+/* Stop stops us handling events. The Slack library can't close its RTM
+ * connection yet, but it won't get any further than its next event once
+ * nobody's listening, and the connection goes when we exit.
+ */
+func (self *EventReceiver) Stop() {
+	close(self.stop)
+}
+
+func (self *EventReceiver) handle(ev slack.SlackEvent) {
+	switch e := ev.Data.(type) {
+	case *slack.MessageEvent:
+		if e.UserId == self.botUserId {
+			return
+		}
+		switch e.SubType {
+		case slackSubtypeChannelJoin, slackSubtypeGroupJoin:
+			go self.standups.MemberJoined(e.ChannelId, e.UserId)
+			return
+		case slackSubtypeChannelLeave, slackSubtypeGroupLeave:
+			self.standups.MemberLeft(e.ChannelId, e.UserId)
+			return
+		}
+		if e.Text == "" {
+			return
+		}
+		Log.With("user_id", e.UserId).With("channel_id", e.ChannelId).Debugf("received message id %s from RTM: %s", e.Timestamp, e.Text)
+		if isIMChannelId(e.ChannelId) {
+			self.userManager.ReceiveMessageReply(*e)
+		} else if self.channelCommands.Mentioned(*e) {
+			go self.channelCommands.Handle(*e)
+		}
+
+	case *slack.PresenceChangeEvent:
+		self.userManager.ReceivePresenceChange(*e)
+
+	case *slack.UserTypingEvent:
+		if isIMChannelId(e.ChannelId) {
+			self.userManager.ReceiveTyping(*e)
+		}
+
+	case *slack.UserChangeEvent:
+		self.userManager.directory.Update(e.User)
+
+	case *slack.TeamJoinEvent:
+		if e.User != nil {
+			self.userManager.directory.Update(*e.User)
+		}
+
+	case *slack.IMCreatedEvent:
+		self.userManager.ReceiveIMChange(e.Channel.Id, e.UserId, true)
+
+	case *slack.IMOpenEvent:
+		self.userManager.ReceiveIMChange(e.ChannelId, e.UserId, true)
+
+	case *slack.IMCloseEvent:
+		self.userManager.ReceiveIMChange(e.ChannelId, e.UserId, false)
+
+	case *slack.ConnectingEvent:
+		Log.Debugf("connecting to RTM, attempt %d", e.Attempt)
+		setRTMState("connecting")
+
+	case *slack.ConnectedEvent:
+		Log.Infof("connected to RTM")
+		setRTMState("connected")
+		if e.Info != nil {
+			self.userManager.directory.Reset(e.Info.Users)
+			self.userManager.ReceiveIMs(e.Info.IMs)
+		}
+		if e.ConnectionCount > 1 {
+			metricRTMReconnects.Inc("")
+		}
+
+	case *slack.DisconnectedEvent:
+		Log.Warnf("disconnected from RTM")
+		setRTMState("disconnected")
+	}
+}
+
+// IM channel ids start with a D, where channels start with C and private
+// groups with G.
+func isIMChannelId(channelId string) bool {
+	return strings.HasPrefix(channelId, "D")
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/abourget/slack"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+/* fakeSlack is just enough of Slack's Web API to run stand-ups against. It
+ * records every message posted, and can be told to fail calls.
+ */
+type fakeSlack struct {
+	server   *httptest.Server
+	mutex    sync.Mutex
+	users    map[string]slack.User
+	away     map[string]bool
+	groups   []map[string]interface{}
+	channels []slack.Channel
+	posts    []fakePost
+	calls    []string
+	failures map[string][]int
+	// failures after doing what was asked
+	lateFailures map[string][]int
+	holds        map[string]chan struct{}
+	n            int
+	oldAPI       string
+}
+
+type fakePost struct {
+	Method      string
+	Channel     string
+	Text        string
+	Attachments string
+	Ts          string
+}
+
+func newFakeSlack(users ...slack.User) *fakeSlack {
+	f := &fakeSlack{
+		users:        make(map[string]slack.User),
+		away:         make(map[string]bool),
+		failures:     make(map[string][]int),
+		lateFailures: make(map[string][]int),
+		holds:        make(map[string]chan struct{}),
+		oldAPI:       slack.SLACK_API,
+	}
+	for _, u := range users {
+		f.users[u.Id] = u
+	}
+	f.server = httptest.NewServer(f)
+	slack.SLACK_API = f.server.URL + "/"
+	return f
+}
+
+func (f *fakeSlack) Close() {
+	slack.SLACK_API = f.oldAPI
+	f.server.Close()
+}
+
+// failNext makes the next calls to a method fail with these HTTP statuses, in
+// turn.
+func (f *fakeSlack) failNext(method string, statuses ...int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.failures[method] = append(f.failures[method], statuses...)
+}
+
+// failAfter is failNext, but Slack does what was asked before failing, as
+// it might when it's struggling.
+func (f *fakeSlack) failAfter(method string, statuses ...int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.lateFailures[method] = append(f.lateFailures[method], statuses...)
+}
+
+// hold keeps calls to a method waiting until they're released, however long
+// that takes.
+func (f *fakeSlack) hold(method string) (release func()) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	held := make(chan struct{})
+	f.holds[method] = held
+	var once sync.Once
+	return func() { once.Do(func() { close(held) }) }
+}
+
+func (f *fakeSlack) setAway(userId string, away bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.away[userId] = away
+}
+
+func (f *fakeSlack) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	method := strings.TrimPrefix(r.URL.Path, "/")
+
+	f.mutex.Lock()
+	f.calls = append(f.calls, method)
+	held := f.holds[method]
+	f.mutex.Unlock()
+	if held != nil {
+		<-held
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if statuses := f.failures[method]; len(statuses) > 0 {
+		f.failures[method] = statuses[1:]
+		if statuses[0] == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "1")
+		}
+		w.WriteHeader(statuses[0])
+		return
+	}
+
+	out := map[string]interface{}{"ok": true}
+	switch method {
+	case "users.info":
+		u, ok := f.users[r.Form.Get("user")]
+		if !ok {
+			out = map[string]interface{}{"ok": false, "error": "user_not_found"}
+		}
+		out["user"] = u
+	case "users.list":
+		members := []slack.User{}
+		for _, u := range f.users {
+			members = append(members, u)
+		}
+		out["members"] = members
+	case "users.getPresence":
+		out["presence"] = slackPresenceActive
+		if f.away[r.Form.Get("user")] {
+			out["presence"] = slackPresenceAway
+		}
+	case "channels.list":
+		channels := []slack.Channel{}
+		channels = append(channels, f.channels...)
+		out["channels"] = channels
+	case "channels.info":
+		out = map[string]interface{}{"ok": false, "error": "channel_not_found"}
+		for _, ch := range f.channels {
+			if ch.Id == r.Form.Get("channel") {
+				out = map[string]interface{}{"ok": true, "channel": ch}
+			}
+		}
+	case "usergroups.list":
+		out["usergroups"] = f.groups
+	case "im.open":
+		out["channel"] = map[string]string{"id": "D" + r.Form.Get("user")}
+	case "im.history":
+		messages := []slack.Msg{}
+		for _, p := range f.posts {
+			if p.Method == "chat.postMessage" && p.Channel == r.Form.Get("channel") && p.Ts > r.Form.Get("oldest") {
+				messages = append(messages, slack.Msg{UserId: "UTILLY", Text: p.Text, Timestamp: p.Ts})
+			}
+		}
+		out["messages"] = messages
+	case "im.list":
+		ims := []map[string]interface{}{}
+		for id := range f.users {
+			ims = append(ims, map[string]interface{}{"id": "D" + id, "user": id, "is_open": true})
+		}
+		out["ims"] = ims
+	case "chat.postMessage", "chat.update", "chat.delete":
+		f.n++
+		ts := r.Form.Get("ts")
+		if method == "chat.postMessage" {
+			ts = fmt.Sprintf("%d.%06d", time.Now().Unix(), f.n)
+		}
+		f.posts = append(f.posts, fakePost{
+			Method:      method,
+			Channel:     r.Form.Get("channel"),
+			Text:        r.Form.Get("text"),
+			Attachments: r.Form.Get("attachments"),
+			Ts:          ts,
+		})
+		out["ts"] = ts
+		out["channel"] = r.Form.Get("channel")
+	default:
+		out = map[string]interface{}{"ok": false, "error": "unknown_method"}
+	}
+
+	if statuses := f.lateFailures[method]; len(statuses) > 0 {
+		f.lateFailures[method] = statuses[1:]
+		w.WriteHeader(statuses[0])
+		return
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+func (f *fakeSlack) Posts() []fakePost {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]fakePost(nil), f.posts...)
+}
+
+func (f *fakeSlack) Calls(method string) (n int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for _, m := range f.calls {
+		if m == method {
+			n++
+		}
+	}
+	return
+}
+
+// DMs are the messages we've sent someone, oldest first.
+func (f *fakeSlack) DMs(userId string) (texts []string) {
+	for _, p := range f.Posts() {
+		if p.Method == "chat.postMessage" && p.Channel == "D"+userId {
+			texts = append(texts, p.Text)
+		}
+	}
+	return
+}
+
+func (f *fakeSlack) ChannelPosts(channelId string) (posts []fakePost) {
+	for _, p := range f.Posts() {
+		if p.Channel == channelId {
+			posts = append(posts, p)
+		}
+	}
+	return
+}
+
+func (f *fakeSlack) waitForDM(t *testing.T, userId, text string) {
+	waitFor(t, fmt.Sprintf("%s to be sent %q", userId, text), func() bool {
+		return countOf(f.DMs(userId), text) > 0
+	})
+}
+
+func countOf(texts []string, text string) (n int) {
+	for _, t := range texts {
+		if t == text {
+			n++
+		}
+	}
+	return
+}
+
+func waitFor(t *testing.T, what string, done func() bool) {
+	for deadline := time.Now().Add(5 * time.Second); !done(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+// testBot is everything that runs stand-ups, talking to a fakeSlack.
+type testBot struct {
+	slack    *fakeSlack
+	client   *AuthedSlack
+	users    *UserManager
+	standups *StandupManager
+	history  *History
+	reported *sync.WaitGroup
+	cleanUp  func()
+}
+
+func newTestBot(t *testing.T, users ...slack.User) *testBot {
+	dir, cleanUp := tempDir(t)
+	preferences, err := LoadPreferences(filepath.Join(dir, "preferences.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	calendars, _ := LoadCalendars(Settings)
+
+	b := &testBot{slack: newFakeSlack(users...), cleanUp: cleanUp}
+	b.client = &AuthedSlack{Client: slack.New("xoxb-test"), UserId: "UTILLY", Token: "xoxb-test"}
+	b.history = NewHistory(filepath.Join(dir, "history.jsonl"))
+	b.users = NewUserManager(b.client, b.history, preferences, calendars)
+	b.reported = new(sync.WaitGroup)
+	b.standups = NewStandupManager(b.client, b.users, b.history, b.reported)
+	return b
+}
+
+func (b *testBot) Close() {
+	b.slack.Close()
+	b.cleanUp()
+}
+
+func (b *testBot) say(userId, text string) {
+	b.users.ReceiveMessageReply(slack.MessageEvent{Msg: slack.Msg{
+		ChannelId: "D" + userId,
+		UserId:    userId,
+		Text:      text,
+		Timestamp: fmt.Sprintf("%d.000100", time.Now().Unix()),
+	}})
+}
+
+// start starts a stand-up and waits until everyone in it's been asked the
+// first question.
+func (b *testBot) start(t *testing.T, ch slack.Channel, asked ...string) *Standup {
+	s, err := b.standups.Start(ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, userId := range asked {
+		b.slack.waitForDM(t, userId, Questions[0])
+	}
+	return s
+}
+
+func (b *testBot) waitReported(t *testing.T) {
+	done := make(chan struct{})
+	go func() {
+		b.reported.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for stand-ups to report")
+	}
+}
+
+func testChannel(id, name string, members ...string) slack.Channel {
+	ch := slack.Channel{Name: name, Members: members}
+	ch.Id = id
+	ch.IsMember = true
+	return ch
+}
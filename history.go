@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultHistoryFile = "tilly-history.jsonl"
+
+const (
+	participantAnswered = "answered"
+	participantPartial  = "partial"
+	participantSkipped  = "skipped"
+	participantAbsent   = "absent"
+	participantError    = "error"
+	participantOnLeave  = "leave"
+	participantAway     = "away"
+	participantExcluded = "excluded"
+)
+
+type StandupRecord struct {
+	Id           string              `json:"id"`
+	ChannelId    string              `json:"channel_id"`
+	ChannelName  string              `json:"channel_name"`
+	Started      time.Time           `json:"started"`
+	Finished     time.Time           `json:"finished"`
+	Interrupted  bool                `json:"interrupted,omitempty"`
+	Questions    []string            `json:"questions"`
+	Participants []ParticipantRecord `json:"participants"`
+}
+
+type ParticipantRecord struct {
+	UserId   string   `json:"user_id"`
+	Name     string   `json:"name"`
+	RealName string   `json:"real_name,omitempty"`
+	Status   string   `json:"status"`
+	Reason   string   `json:"reason,omitempty"`
+	Answers  []string `json:"answers,omitempty"`
+	// The Slack timestamp of the message each answer came in
+	AnswerTimestamps []string   `json:"answer_timestamps,omitempty"`
+	Started          *time.Time `json:"started,omitempty"`
+	Completed        *time.Time `json:"completed,omitempty"`
+}
+
+// Asked says whether we actually asked them, rather than leaving them out.
+func (r ParticipantRecord) Asked() bool {
+	return r.Status != participantOnLeave && r.Status != participantAway &&
+		r.Status != participantExcluded
+}
+
+func (r ParticipantRecord) Responded() bool {
+	return r.Status == participantAnswered || r.Status == participantPartial
+}
+
+// AnsweredAt says when they answered a question, if they did.
+func (r ParticipantRecord) AnsweredAt(qidx int) (time.Time, bool) {
+	if qidx >= len(r.AnswerTimestamps) {
+		return time.Time{}, false
+	}
+	return parseSlackTimestamp(r.AnswerTimestamps[qidx])
+}
+
+// Latency is how long they took to answer a question, from when we asked it:
+// as soon as they'd answered the one before, or we started asking them.
+func (r ParticipantRecord) Latency(rec StandupRecord, qidx int) (time.Duration, bool) {
+	answered, ok := r.AnsweredAt(qidx)
+	if !ok {
+		return 0, false
+	}
+	asked := rec.Started
+	if r.Started != nil {
+		asked = *r.Started
+	}
+	if qidx > 0 {
+		if asked, ok = r.AnsweredAt(qidx - 1); !ok {
+			return 0, false
+		}
+	}
+	if answered.Before(asked) {
+		// Slack's clock and ours don't quite agree
+		return 0, true
+	}
+	return answered.Sub(asked), true
+}
+
+// Slack timestamps are seconds and microseconds, like 1476871234.000200.
+func parseSlackTimestamp(ts string) (time.Time, bool) {
+	parts := strings.SplitN(ts, ".", 2)
+	secs, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	var micros int64
+	if len(parts) == 2 {
+		if micros, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+			return time.Time{}, false
+		}
+	}
+	return time.Unix(secs, micros*int64(time.Microsecond)), true
+}
+
+/* History is an append-only log of finished stand-ups, one JSON record per
+ * line. It's deliberately dumb: we run once a day, so it's never big enough
+ * to need more than reading the whole thing back in.
+ */
+type History struct {
+	path  string
+	mutex sync.Mutex
+}
+
+func NewHistory(path string) *History {
+	return &History{path: path}
+}
+
+func (self *History) Append(r StandupRecord) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	f, err := os.OpenFile(self.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+/* Load returns every recorded stand-up, oldest first. A line that isn't a
+ * whole record, like one we were in the middle of writing when we crashed, or
+ * are writing now from another process, is logged and left out, rather than
+ * costing us the rest.
+ */
+func (self *History) Load() (records []StandupRecord, err error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	f, err := os.Open(self.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var r StandupRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			Log.With("path", self.path).With("line", line).Errorf("skipping bad history record: %s", err)
+			continue
+		}
+		records = append(records, r)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Stable(recordsByStart(records))
+	return records, nil
+}
+
+type recordsByStart []StandupRecord
+
+func (rs recordsByStart) Len() int           { return len(rs) }
+func (rs recordsByStart) Less(i, j int) bool { return rs[i].Started.Before(rs[j].Started) }
+func (rs recordsByStart) Swap(i, j int)      { rs[i], rs[j] = rs[j], rs[i] }
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "tilly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func tempHistory(t *testing.T) (*History, func()) {
+	dir, cleanUp := tempDir(t)
+	return NewHistory(filepath.Join(dir, "history.jsonl")), cleanUp
+}
+
+func TestHistoryLoadMissingFile(t *testing.T) {
+	history, cleanUp := tempHistory(t)
+	defer cleanUp()
+
+	records, err := history.Load()
+	if err != nil || len(records) != 0 {
+		t.Fatalf("got %v, %v; want nothing", records, err)
+	}
+}
+
+func TestHistoryLoadOrdersByStart(t *testing.T) {
+	history, cleanUp := tempHistory(t)
+	defer cleanUp()
+
+	today := time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)
+	for _, r := range []StandupRecord{
+		{Id: "today", Started: today},
+		{Id: "yesterday", Started: today.AddDate(0, 0, -1)},
+	} {
+		if err := history.Append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := history.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Id != "yesterday" || records[1].Id != "today" {
+		t.Errorf("got %v; want yesterday then today", records)
+	}
+}
+
+func TestHistoryLoadSkipsBadLines(t *testing.T) {
+	history, cleanUp := tempHistory(t)
+	defer cleanUp()
+
+	if err := history.Append(StandupRecord{Id: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(history.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// as if we'd crashed half way through writing one
+	f.WriteString(`{"id": "torn", "channel_id": "C1", "partici` + "\n\n")
+	f.Close()
+	if err := history.Append(StandupRecord{Id: "last"}); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := history.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Id != "first" || records[1].Id != "last" {
+		t.Errorf("got %v; want first and last", records)
+	}
+}
+
+func TestParseSlackTimestamp(t *testing.T) {
+	tests := []struct {
+		ts   string
+		want time.Time
+		ok   bool
+	}{
+		{"1476871234.000200", time.Unix(1476871234, 200*int64(time.Microsecond)), true},
+		{"1476871234", time.Unix(1476871234, 0), true},
+		{"", time.Time{}, false},
+		{"soon.001", time.Time{}, false},
+		{"1476871234.later", time.Time{}, false},
+	}
+	for _, test := range tests {
+		got, ok := parseSlackTimestamp(test.ts)
+		if ok != test.ok || !got.Equal(test.want) {
+			t.Errorf("parseSlackTimestamp(%q) = %s, %t; want %s, %t", test.ts, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestLatency(t *testing.T) {
+	started := time.Unix(1000, 0)
+	asked := time.Unix(1060, 0)
+	rec := StandupRecord{Started: started}
+	p := ParticipantRecord{
+		Answers:          []string{"a", "b", "c", ""},
+		AnswerTimestamps: []string{"1090.000000", "1150.500000", "1140.000000", ""},
+	}
+
+	withStart := p
+	withStart.Started = &asked
+
+	tests := []struct {
+		p     ParticipantRecord
+		qidx  int
+		want  time.Duration
+		found bool
+	}{
+		// from the start of the stand-up, then from the answer before
+		{p, 0, 90 * time.Second, true},
+		{p, 1, 60*time.Second + 500*time.Millisecond, true},
+		// before the answer before, by Slack's clock
+		{p, 2, 0, true},
+		{p, 3, 0, false},
+		{p, 4, 0, false},
+		// from when we started asking them
+		{withStart, 0, 30 * time.Second, true},
+	}
+	for _, test := range tests {
+		got, found := test.p.Latency(rec, test.qidx)
+		if got != test.want || found != test.found {
+			t.Errorf("Latency(%d) = %s, %t; want %s, %t", test.qidx, got, found, test.want, test.found)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"github.com/abourget/slack"
+)
+
+/* imDirectory knows who each of our IM channels is with, from the list Slack
+ * gives us when we connect to RTM and the events it sends as they're created,
+ * opened and closed. That saves asking Slack about every new conversation.
+ * Only the UserManager's goroutine uses it.
+ */
+type imDirectory struct {
+	userIds    map[string]string // by IM channel id
+	channelIds map[string]string // by user id
+	open       map[string]bool   // by IM channel id
+}
+
+type imChange struct {
+	channelId string
+	userId    string
+	open      bool
+}
+
+func newIMDirectory() *imDirectory {
+	return &imDirectory{
+		userIds:    make(map[string]string),
+		channelIds: make(map[string]string),
+		open:       make(map[string]bool),
+	}
+}
+
+// reset replaces everything we know with a fresh list from Slack.
+func (self *imDirectory) reset(ims []slack.IM) {
+	*self = *newIMDirectory()
+	for _, im := range ims {
+		self.add(im.Id, im.UserId, im.IsOpen)
+	}
+}
+
+func (self *imDirectory) add(channelId, userId string, open bool) {
+	self.userIds[channelId] = userId
+	self.channelIds[userId] = channelId
+	self.open[channelId] = open
+}
+
+func (self *imDirectory) change(c imChange) {
+	if c.userId == "" {
+		// Slack doesn't always say who it's with if we know already
+		if c.userId = self.userIds[c.channelId]; c.userId == "" {
+			return
+		}
+	}
+	self.add(c.channelId, c.userId, c.open)
+}
+
+func (self *imDirectory) userId(channelId string) (userId string, ok bool) {
+	userId, ok = self.userIds[channelId]
+	return
+}
+
+func (self *imDirectory) channelId(userId string) (channelId string, open bool) {
+	channelId = self.channelIds[userId]
+	return channelId, self.open[channelId]
+}
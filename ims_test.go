@@ -0,0 +1,90 @@
+package main
+
+import (
+	"github.com/abourget/slack"
+	"testing"
+)
+
+func im(channelId, userId string, open bool) slack.IM {
+	i := slack.IM{UserId: userId}
+	i.Id, i.IsOpen = channelId, open
+	return i
+}
+
+func TestIMDirectory(t *testing.T) {
+	ims := newIMDirectory()
+	ims.add("D0", "U0", true)
+	ims.reset([]slack.IM{im("D1", "U1", true), im("D2", "U2", false)})
+
+	// what we knew before is gone
+	if _, ok := ims.userId("D0"); ok {
+		t.Error("still know D0 after a reset")
+	}
+	if channelId, open := ims.channelId("U2"); channelId != "D2" || open {
+		t.Errorf("got %s, open %t for U2; want D2, closed", channelId, open)
+	}
+
+	ims.change(imChange{channelId: "D2", open: true})
+	ims.change(imChange{channelId: "D1", userId: "U1", open: false})
+	ims.change(imChange{channelId: "D3", userId: "U3", open: true})
+	// we can't say who it's with
+	ims.change(imChange{channelId: "D4", open: true})
+
+	tests := []struct {
+		userId, channelId string
+		open              bool
+	}{
+		{"U1", "D1", false},
+		{"U2", "D2", true},
+		{"U3", "D3", true},
+		{"U4", "", false},
+	}
+	for _, test := range tests {
+		if channelId, open := ims.channelId(test.userId); channelId != test.channelId || open != test.open {
+			t.Errorf("got %q, open %t for %s; want %q, open %t", channelId, open, test.userId, test.channelId, test.open)
+		}
+	}
+	if userId, ok := ims.userId("D3"); userId != "U3" || !ok {
+		t.Errorf("got %q, %t for D3; want U3", userId, ok)
+	}
+	if _, ok := ims.userId("D4"); ok {
+		t.Error("know D4, without knowing who it's with")
+	}
+}
+
+func TestMessagesFromIMs(t *testing.T) {
+	b := newTestBot(t,
+		slack.User{Id: "U1", Name: "bob"},
+		slack.User{Id: "U2", Name: "amy"},
+		slack.User{Id: "U3", Name: "cat"})
+	defer b.Close()
+	b.users.ReceiveIMs([]slack.IM{im("DU1", "U1", true)})
+	b.users.ReceiveIMChange("DU2", "U2", true)
+
+	// we know these, so there's no need to ask Slack
+	b.say("U1", "stats")
+	b.slack.waitForDM(t, "U1", UserNoStatsText)
+	b.say("U2", "stats")
+	b.slack.waitForDM(t, "U2", UserNoStatsText)
+	if n := b.slack.Calls("im.list"); n != 0 {
+		t.Errorf("listed IMs %d times; want none", n)
+	}
+
+	// cat's message beat Slack telling us about it
+	b.say("U3", "stats")
+	b.slack.waitForDM(t, "U3", UserNoStatsText)
+	if n := b.slack.Calls("im.list"); n != 1 {
+		t.Errorf("listed IMs %d times; want once", n)
+	}
+
+	// and a channel Slack doesn't know either is nobody's
+	b.users.ReceiveMessageReply(slack.MessageEvent{Msg: slack.Msg{ChannelId: "DNOBODY", UserId: "U9", Text: "stats"}})
+	b.say("U3", "stats")
+	waitFor(t, "cat's stats again", func() bool { return countOf(b.slack.DMs("U3"), UserNoStatsText) == 2 })
+	if n := b.slack.Calls("im.list"); n != 2 {
+		t.Errorf("listed IMs %d times; want twice", n)
+	}
+	if n := len(b.slack.Posts()); n != 4 {
+		t.Errorf("got %d posts; want nothing sent to nobody", n)
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const defaultLocale = "en"
+
+/* A Catalogue is everything we say in one language: the questions, our
+ * templates by name (see templates.go), the nags, our replies by name (see
+ * replies.go) and what the days are called. Anything a catalogue leaves out
+ * is in English. Config "locales" can add catalogues or change ours, keyed by
+ * locale.
+ *
+ * People are asked in the language they've chosen, or otherwise their
+ * channel's. The summary is always in the channel's.
+ */
+type Catalogue struct {
+	// What we call the language, in it.
+	Name      string            `json:"name"`
+	Questions []string          `json:"questions"`
+	Templates map[string]string `json:"templates"`
+	Nags      []string          `json:"nags"`
+	Replies   map[string]string `json:"replies"`
+	// Sunday first.
+	Days []string `json:"days"`
+}
+
+var builtinCatalogues = map[string]Catalogue{
+	"en": {Name: "English"},
+
+	"pt": {
+		Name: "Português",
+		Questions: []string{
+			"O que você fez ontem?",
+			"O que você planeja fazer hoje?",
+			"Alguma coisa está bloqueando você? Se sim, o quê?",
+			"Como você está se sentindo?",
+		},
+		Templates: map[string]string{
+			templateStart:           "*AU AU!* O stand-up de #{{.Channel}} está começando.\nMande `skip` para ficar de fora desta vez.",
+			templateThanks:          "Obrigado! Tudo pronto.",
+			templateSkipConfirmed:   "Certo!",
+			templateTimeUp:          "Tarde demais! O stand-up já terminou. Confira o canal.",
+			templateEndedEarly:      "O stand-up foi encerrado mais cedo, desculpe! Confira o canal.",
+			templateCancelled:       "Deixa pra lá, o stand-up foi cancelado.",
+			templateInterrupted:     "Desculpe, preciso sair! Vou publicar o que você já me disse em #{{.Channel}}.",
+			templateLeftChannel:     "Você saiu de #{{.Channel}}, então esqueça esse stand-up.",
+			templateAlreadyFinished: "Seu próximo stand-up seria de #{{.Channel}}, mas ele já terminou. Confira o canal.",
+			templateNextStandup:     "Mas espere, você tem outro stand-up…",
+
+			templateSummary: `{{if not .Final}}*Stand-up em andamento!* Vou atualizar isto conforme as pessoas terminarem.
+As perguntas são:
+{{else if .Interrupted}}<!here>: *Stand-up interrompido!* Tive que parar antes, então isto é o que recebi.
+As perguntas foram:
+{{else}}<!here>: *AU AU AU! Stand-up concluído!*
+As perguntas foram:
+{{end}}{{range .Questions}}• {{.}}
+{{end}}
+{{range .Sections}}{{.}}{{end}}`,
+			templateAnswered: `{{.User}} respondeu{{with .Took}} em {{.}}{{end}}:
+{{range .Answers}}• {{.}}
+{{end}}{{if .Partial}}mas não respondeu ao resto.
+{{end}}
+`,
+			templateAbsent:   "{{.User}} {{if .Interrupted}}ainda não tinha respondido.{{else}}nunca me respondeu :disappointed:{{end}}\n",
+			templateSkipped:  "{{.User}} pulou este stand-up.\n",
+			templateError:    "Houve um erro ao tentar falar com {{.User}}\n",
+			templateOnLeave:  "{{.User}} está de folga.\n",
+			templateAway:     "{{.User}} está ausente.\n",
+			templateExcluded: "{{.User}} não foi perguntado: {{.Reason}}.\n",
+
+			templateAttachmentsHeading: "{{if not .Final}}*Stand-up em andamento!* Vou atualizar isto conforme as pessoas terminarem.{{else if .Interrupted}}<!here>: *Stand-up interrompido!* Tive que parar antes, então isto é o que recebi.{{else}}<!here>: *AU AU AU! Stand-up concluído!*{{end}}",
+			templateAttachmentsPartial: "Não respondeu ao resto.",
+			templateAttachmentsFooter:  `{{if .Absent}}{{if .Interrupted}}Ainda não responderam{{else}}Nunca responderam{{end}}: {{join .Absent ", "}}. {{end}}{{if .Skipped}}Pularam: {{join .Skipped ", "}}. {{end}}{{if .Errors}}Erro ao falar com: {{join .Errors ", "}}. {{end}}{{if .OnLeave}}De folga: {{join .OnLeave ", "}}. {{end}}{{if .Away}}Ausentes: {{join .Away ", "}}. {{end}}{{if .Excluded}}Não perguntados: {{join .Excluded ", "}}.{{end}}`,
+
+			templateStreak: ":fire: {{.User}} respondeu {{.Days}} dias seguidos",
+		},
+		Nags: []string{
+			"Não se esqueça de me responder!",
+		},
+		Replies: map[string]string{
+			replyAdminStarted:        "Certo, começando um stand-up em #{{.Channel}}.",
+			replyAdminEnded:          "Certo, encerrei #{{.Channel}} e publiquei o resumo.",
+			replyAdminCancelled:      "Certo, cancelei o stand-up em #{{.Channel}}.",
+			replyAdminExtended:       "Certo, #{{.Channel}} agora termina às {{.Ends.Format \"15:04\"}}.",
+			replyAdminAlreadyRunning: "Já há um stand-up em andamento em #{{.Channel}}.",
+			replyAdminNotRunning:     "Não há nenhum stand-up em andamento em #{{.Channel}}.",
+			replyAdminNothingRunning: "Não há nenhum stand-up em andamento.",
+			replyAdminShuttingDown:   "Estou desligando, então não posso começar um stand-up em #{{.Channel}}.",
+			replyAdminNotMember:      "Não estou em #{{.Channel}}, me convide primeiro.",
+			replyAdminUnknownChannel: "Não encontro nenhum canal chamado {{.Channel}}.",
+			replyAdminChannelError:   "Desculpe, algo deu errado ao procurar {{.Channel}}.",
+			replyAdminStatus: `*#{{.Channel}}*, começou às {{.Started.Format "15:04"}}, termina às {{.Ends.Format "15:04"}}:
+{{range .People}}• {{.User}} {{if .Absent}}ainda não respondeu{{else if .Skipped}}pulou{{else if .Error}}não pôde ser contatado{{else}}respondeu {{.Answered}} de {{.Questions}}{{end}}
+{{else}}Ninguém foi perguntado ainda.
+{{end}}`,
+
+			replyMentionStarted:        "*AU AU!* Começando um stand-up, confira suas mensagens diretas.",
+			replyMentionAlreadyRunning: "Já há um stand-up em andamento aqui.",
+			replyMentionShuttingDown:   "Estou desligando, então não posso começar um stand-up agora.",
+			replyMentionNotRunning:     "Não há nenhum stand-up em andamento aqui agora.",
+			replyMentionSkipped:        "Certo {{.User}}, você vai pular este.",
+			replyMentionNotAsked:       "{{.User}}, não há nada para você pular: não te perguntei neste stand-up, ou você já terminou.",
+			replyMentionMissing:        "Ainda esperando por {{join .Users \", \"}}.",
+			replyMentionNobodyMissing:  "Ninguém! Todos já responderam.",
+			replyMentionError:          "Desculpe, algo deu errado.",
+			replyMentionHelp:           "Me mencione com `standup now` para começar um stand-up aqui, `skip today` para pular, ou `who's missing?` para ver quem ainda não respondeu.",
+
+			replyNoPreferences: "Pergunto a você em todos os stand-ups dos canais em que você está.",
+			replyPreferences: `{{if .Paused}}Você está em pausa até {{.Until.Format "02/01/2006"}}.
+{{end}}{{with .OptedOut}}Você saiu de {{join . ", "}}.
+{{end}}{{with .Weekdays}}Só pergunto a você em: {{join . ", "}}.
+{{end}}{{with .Language}}Pergunto a você em {{.}}.
+{{end}}`,
+			replyPreferencesError: "Desculpe, não consegui salvar isso.",
+			replyBadDate:          "Preciso de datas como 2026-11-02.",
+			replyPaused:           "Certo, não vou te perguntar em nenhum stand-up até {{.Until.Format \"02/01\"}}. Aproveite!",
+			replyResumed:          "Bem-vindo de volta!",
+			replyOptedOut:         "Certo, não vou mais te perguntar nos stand-ups de #{{.Channel}}.",
+			replyOptedIn:          "Certo, vou voltar a te perguntar nos stand-ups de #{{.Channel}}.",
+			replyWeekdays:         "Certo, só vou te perguntar nesses dias.",
+			replyEveryDay:         "Certo, vou te perguntar todos os dias.",
+			replyLanguage:         "Certo, a partir de agora vou te perguntar em {{.Language}}.",
+			replyDefaultLanguage:  "Certo, vou te perguntar no idioma de cada canal.",
+			replyUnknownLanguage:  "Não falo {{.Language}}. Falo {{.Languages}}.",
+			replyNoStats:          "Ainda não te perguntei em nenhum stand-up.",
+			replyStats: `Você foi perguntado em {{.Asked}} stand-ups e respondeu {{.Rate}}% deles ({{.Answered}} por completo, {{.Partial}} em parte, {{.Skipped}} pulados, {{.Missed}} perdidos).
+{{with .Average}}Você leva {{.}} para terminar, em média.
+{{end}}Sua sequência atual é de {{.Streak}} dias, e a melhor foi de {{.LongestStreak}}.`,
+			replySnoozed:    "Certo, sem mais lembretes sobre este.",
+			replySnoozedFor: "Certo, sem lembretes por {{.Minutes}} minutos.",
+		},
+		Days: []string{"domingo", "segunda-feira", "terça-feira", "quarta-feira", "quinta-feira", "sexta-feira", "sábado"},
+	},
+
+	"de": {
+		Name: "Deutsch",
+		Questions: []string{
+			"Was hast du gestern gemacht?",
+			"Was hast du heute vor?",
+			"Blockiert dich etwas? Wenn ja, was?",
+			"Wie geht es dir?",
+		},
+		Templates: map[string]string{
+			templateStart:           "*WUFF!* Das Stand-up für #{{.Channel}} beginnt.\nSchreib mir `skip`, um diesmal auszusetzen.",
+			templateThanks:          "Danke! Alles erledigt.",
+			templateSkipConfirmed:   "Okay!",
+			templateTimeUp:          "Zu spät! Das Stand-up ist schon vorbei. Schau im Channel nach.",
+			templateEndedEarly:      "Das Stand-up wurde früher beendet, sorry! Schau im Channel nach.",
+			templateCancelled:       "Vergiss es, das Stand-up wurde abgesagt.",
+			templateInterrupted:     "Sorry, ich muss los! Ich poste, was du mir bisher gesagt hast, in #{{.Channel}}.",
+			templateLeftChannel:     "Du hast #{{.Channel}} verlassen, also vergiss das Stand-up.",
+			templateAlreadyFinished: "Dein nächstes Stand-up wäre für #{{.Channel}} gewesen, aber es ist schon vorbei. Schau im Channel nach.",
+			templateNextStandup:     "Aber warte, du hast noch ein Stand-up…",
+
+			templateSummary: `{{if not .Final}}*Stand-up läuft!* Ich aktualisiere das, sobald alle fertig sind.
+Die Fragen sind:
+{{else if .Interrupted}}<!here>: *Stand-up unterbrochen!* Ich musste früher aufhören, das hier habe ich bekommen.
+Die Fragen waren:
+{{else}}<!here>: *WUFFWUFFWUFF Stand-up fertig!*
+Die Fragen waren:
+{{end}}{{range .Questions}}• {{.}}
+{{end}}
+{{range .Sections}}{{.}}{{end}}`,
+			templateAnswered: `{{.User}} hat{{with .Took}} in {{.}}{{end}} geantwortet:
+{{range .Answers}}• {{.}}
+{{end}}{{if .Partial}}aber den Rest nicht beantwortet.
+{{end}}
+`,
+			templateAbsent:   "{{.User}} {{if .Interrupted}}hat noch nicht geantwortet.{{else}}hat mir nie geantwortet :disappointed:{{end}}\n",
+			templateSkipped:  "{{.User}} hat dieses Stand-up ausgelassen.\n",
+			templateError:    "Beim Chatten mit {{.User}} ist ein Fehler aufgetreten\n",
+			templateOnLeave:  "{{.User}} ist im Urlaub.\n",
+			templateAway:     "{{.User}} ist abwesend.\n",
+			templateExcluded: "{{.User}} wurde nicht gefragt: {{.Reason}}.\n",
+
+			templateAttachmentsHeading: "{{if not .Final}}*Stand-up läuft!* Ich aktualisiere das, sobald alle fertig sind.{{else if .Interrupted}}<!here>: *Stand-up unterbrochen!* Ich musste früher aufhören, das hier habe ich bekommen.{{else}}<!here>: *WUFFWUFFWUFF Stand-up fertig!*{{end}}",
+			templateAttachmentsPartial: "Hat den Rest nicht beantwortet.",
+			templateAttachmentsFooter:  `{{if .Absent}}{{if .Interrupted}}Noch keine Antwort{{else}}Nie geantwortet{{end}}: {{join .Absent ", "}}. {{end}}{{if .Skipped}}Ausgelassen: {{join .Skipped ", "}}. {{end}}{{if .Errors}}Fehler beim Chatten mit: {{join .Errors ", "}}. {{end}}{{if .OnLeave}}Im Urlaub: {{join .OnLeave ", "}}. {{end}}{{if .Away}}Abwesend: {{join .Away ", "}}. {{end}}{{if .Excluded}}Nicht gefragt: {{join .Excluded ", "}}.{{end}}`,
+
+			templateStreak: ":fire: {{.User}} hat {{.Days}} Tage in Folge geantwortet",
+		},
+		Nags: []string{
+			"Vergiss nicht, mir zu antworten!",
+		},
+		Replies: map[string]string{
+			replyAdminStarted:        "Okay, ich starte ein Stand-up in #{{.Channel}}.",
+			replyAdminEnded:          "Okay, ich habe #{{.Channel}} beendet und die Zusammenfassung gepostet.",
+			replyAdminCancelled:      "Okay, ich habe das Stand-up in #{{.Channel}} abgesagt.",
+			replyAdminExtended:       "Okay, #{{.Channel}} endet jetzt um {{.Ends.Format \"15:04\"}}.",
+			replyAdminAlreadyRunning: "In #{{.Channel}} läuft schon ein Stand-up.",
+			replyAdminNotRunning:     "In #{{.Channel}} läuft kein Stand-up.",
+			replyAdminNothingRunning: "Es laufen keine Stand-ups.",
+			replyAdminShuttingDown:   "Ich fahre gerade herunter, also kann ich in #{{.Channel}} kein Stand-up starten.",
+			replyAdminNotMember:      "Ich bin nicht in #{{.Channel}}, lade mich zuerst ein.",
+			replyAdminUnknownChannel: "Ich finde keinen Channel namens {{.Channel}}.",
+			replyAdminChannelError:   "Sorry, beim Nachschlagen von {{.Channel}} ist etwas schiefgegangen.",
+			replyAdminStatus: `*#{{.Channel}}*, gestartet um {{.Started.Format "15:04"}}, endet um {{.Ends.Format "15:04"}}:
+{{range .People}}• {{.User}} {{if .Absent}}hat noch nicht geantwortet{{else if .Skipped}}hat ausgesetzt{{else if .Error}}war nicht erreichbar{{else}}hat {{.Answered}} von {{.Questions}} beantwortet{{end}}
+{{else}}Es wurde noch niemand gefragt.
+{{end}}`,
+
+			replyMentionStarted:        "*WUFF!* Ich starte ein Stand-up, schaut in eure DMs.",
+			replyMentionAlreadyRunning: "Hier läuft schon ein Stand-up.",
+			replyMentionShuttingDown:   "Ich fahre gerade herunter, also kann ich jetzt kein Stand-up starten.",
+			replyMentionNotRunning:     "Hier läuft gerade kein Stand-up.",
+			replyMentionSkipped:        "Okay {{.User}}, du setzt diesmal aus.",
+			replyMentionNotAsked:       "{{.User}}, da gibt es nichts auszusetzen: Ich habe dich zu diesem Stand-up nicht gefragt, oder du bist schon fertig.",
+			replyMentionMissing:        "Ich warte noch auf {{join .Users \", \"}}.",
+			replyMentionNobodyMissing:  "Niemand! Alle haben geantwortet.",
+			replyMentionError:          "Sorry, da ist etwas schiefgegangen.",
+			replyMentionHelp:           "Erwähne mich mit `standup now`, um hier ein Stand-up zu starten, `skip today`, um auszusetzen, oder `who's missing?`, um zu sehen, wer noch nicht geantwortet hat.",
+
+			replyNoPreferences: "Ich frage dich bei jedem Stand-up in den Channels, in denen du bist.",
+			replyPreferences: `{{if .Paused}}Du pausierst bis {{.Until.Format "02.01.2006"}}.
+{{end}}{{with .OptedOut}}Du hast dich von {{join . ", "}} abgemeldet.
+{{end}}{{with .Weekdays}}Ich frage dich nur am {{join . ", "}}.
+{{end}}{{with .Language}}Ich frage dich auf {{.}}.
+{{end}}`,
+			replyPreferencesError: "Sorry, das konnte ich nicht speichern.",
+			replyBadDate:          "Ich brauche Daten wie 2026-11-02.",
+			replyPaused:           "Okay, ich frage dich bis zum {{.Until.Format \"02.01.\"}} zu keinem Stand-up. Viel Spaß!",
+			replyResumed:          "Willkommen zurück!",
+			replyOptedOut:         "Okay, ich frage dich nicht mehr zu Stand-ups in #{{.Channel}}.",
+			replyOptedIn:          "Okay, ich frage dich wieder zu Stand-ups in #{{.Channel}}.",
+			replyWeekdays:         "Okay, ich frage dich nur an diesen Tagen.",
+			replyEveryDay:         "Okay, ich frage dich jeden Tag.",
+			replyLanguage:         "Okay, ich frage dich ab jetzt auf {{.Language}}.",
+			replyDefaultLanguage:  "Okay, ich frage dich in der Sprache des jeweiligen Channels.",
+			replyUnknownLanguage:  "Ich spreche kein {{.Language}}. Ich kann {{.Languages}}.",
+			replyNoStats:          "Ich habe dich noch zu keinem Stand-up gefragt.",
+			replyStats: `Du wurdest zu {{.Asked}} Stand-ups gefragt und hast {{.Rate}}% davon beantwortet ({{.Answered}} vollständig, {{.Partial}} teilweise, {{.Skipped}} ausgesetzt, {{.Missed}} verpasst).
+{{with .Average}}Du brauchst im Schnitt {{.}}, um fertig zu werden.
+{{end}}Deine aktuelle Serie ist {{.Streak}} Tage lang, deine beste {{.LongestStreak}}.`,
+			replySnoozed:    "Okay, keine Erinnerungen mehr zu diesem.",
+			replySnoozedFor: "Okay, {{.Minutes}} Minuten lang keine Erinnerungen.",
+		},
+		Days: []string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+	},
+}
+
+// Catalogue returns a locale's catalogue, ours with anything configured for
+// it on top.
+func (self *Config) Catalogue(locale string) (cat Catalogue, ok bool) {
+	cat, ok = builtinCatalogues[locale]
+	custom, configured := self.Locales[locale]
+	if !configured {
+		return
+	}
+	if custom.Name != "" {
+		cat.Name = custom.Name
+	}
+	if len(custom.Questions) > 0 {
+		cat.Questions = custom.Questions
+	}
+	if len(custom.Nags) > 0 {
+		cat.Nags = custom.Nags
+	}
+	if len(custom.Days) > 0 {
+		cat.Days = custom.Days
+	}
+	cat.Templates = mergeTemplates(cat.Templates, custom.Templates)
+	cat.Replies = mergeTemplates(cat.Replies, custom.Replies)
+	return cat, true
+}
+
+func mergeTemplates(base, overrides map[string]string) map[string]string {
+	if len(overrides) == 0 {
+		return base
+	}
+	merged := make(map[string]string, len(base)+len(overrides))
+	for name, text := range base {
+		merged[name] = text
+	}
+	for name, text := range overrides {
+		merged[name] = text
+	}
+	return merged
+}
+
+func (self *Config) locales() []string {
+	var locales []string
+	for locale := range builtinCatalogues {
+		locales = append(locales, locale)
+	}
+	for locale := range self.Locales {
+		if _, ok := builtinCatalogues[locale]; !ok {
+			locales = append(locales, locale)
+		}
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// FindLocale looks for a locale by its name, like pt or pt-BR, or the name of
+// its language, like Português.
+func (self *Config) FindLocale(ref string) (locale string, ok bool) {
+	ref = strings.ToLower(ref)
+	language := strings.FieldsFunc(ref, func(r rune) bool {
+		return r == '-' || r == '_'
+	})
+	for _, locale = range self.locales() {
+		cat, _ := self.Catalogue(locale)
+		l := strings.ToLower(locale)
+		if l == ref || strings.ToLower(cat.Name) == ref || len(language) > 0 && l == language[0] {
+			return locale, true
+		}
+	}
+	return "", false
+}
+
+// DescribeLocales lists the languages we speak, for people choosing one.
+func (self *Config) DescribeLocales() string {
+	var names []string
+	for _, locale := range self.locales() {
+		cat, _ := self.Catalogue(locale)
+		names = append(names, fmt.Sprintf("%s (`%s`)", cat.Name, locale))
+	}
+	return strings.Join(names, ", ")
+}
+
+/* Templates parses what we say in a locale about a channel's stand-ups: the
+ * locale's catalogue and, if it's the channel's own, the channel's overrides.
+ * Questions have to match ours one for one, since answers are kept by
+ * question.
+ */
+func (self *Config) Templates(cc ChannelConfig, locale string) (*Templates, error) {
+	cat, ok := self.Catalogue(locale)
+	if !ok {
+		return nil, fmt.Errorf("there's no locale called %s", locale)
+	}
+	overrides, nags := cat.Templates, cat.Nags
+	if locale == cc.Locale {
+		overrides = mergeTemplates(overrides, cc.Templates)
+		if len(cc.Nags) > 0 {
+			nags = cc.Nags
+		}
+	}
+	if len(overrides) == 0 && len(nags) == 0 && len(cat.Questions) == 0 {
+		return builtinTemplates, nil
+	}
+
+	questions := cat.Questions
+	if len(questions) == 0 {
+		questions = Questions
+	} else if len(questions) != len(Questions) {
+		return nil, fmt.Errorf("locale %s has %d questions, not %d", locale, len(questions), len(Questions))
+	}
+	if len(nags) == 0 {
+		nags = UserNagMessages
+	}
+	return parseTemplates(overrides, nags, questions)
+}
+
+// Replies parses what we reply in a locale.
+func (self *Config) Replies(locale string) (*Replies, error) {
+	cat, ok := self.Catalogue(locale)
+	if !ok {
+		return nil, fmt.Errorf("there's no locale called %s", locale)
+	}
+	if len(cat.Replies) == 0 && len(cat.Days) == 0 {
+		return builtinReplies, nil
+	}
+	return parseReplies(cat.Replies, cat.Days)
+}
+
+// DefaultLocale is the locale of any channel that doesn't choose its own.
+func (self *Config) DefaultLocale() string {
+	// we validated the defaults on loading
+	cc, _ := self.channel(nil)
+	return cc.Locale
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/abourget/slack"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuiltinCatalogues(t *testing.T) {
+	config := &Config{}
+	for locale, cat := range builtinCatalogues {
+		if _, err := config.Templates(ChannelConfig{}, locale); err != nil {
+			t.Errorf("%s: %s", locale, err)
+		}
+		if _, err := config.Replies(locale); err != nil {
+			t.Errorf("%s: %s", locale, err)
+		}
+		if locale == defaultLocale {
+			continue
+		}
+		// translations shouldn't fall back on English
+		for name := range defaultTemplates {
+			if _, ok := cat.Templates[name]; !ok {
+				t.Errorf("%s has no template %s", locale, name)
+			}
+		}
+		for name := range defaultReplies {
+			if _, ok := cat.Replies[name]; !ok {
+				t.Errorf("%s has no reply %s", locale, name)
+			}
+		}
+		if len(cat.Nags) == 0 || len(cat.Days) != 7 {
+			t.Errorf("%s has %d nags and %d days", locale, len(cat.Nags), len(cat.Days))
+		}
+	}
+}
+
+func TestCatalogueOverrides(t *testing.T) {
+	config := &Config{Locales: map[string]Catalogue{
+		"pt": {Templates: map[string]string{templateThanks: "Valeu!"}, Replies: map[string]string{replyResumed: "Oi de novo!"}},
+		"fr": {Name: "Français", Replies: map[string]string{replyResumed: "Bon retour !"}},
+	}}
+
+	pt, ok := config.Catalogue("pt")
+	if !ok || pt.Name != "Português" || pt.Templates[templateThanks] != "Valeu!" ||
+		pt.Templates[templateCancelled] != builtinCatalogues["pt"].Templates[templateCancelled] {
+		t.Errorf("got %+v; want ours, with thanks changed", pt)
+	}
+	replies, err := config.Replies("pt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := replies.Render(replyResumed, nil); got != "Oi de novo!" {
+		t.Errorf("got %q; want the configured reply", got)
+	}
+	if got := replies.Day(time.Monday); got != "segunda-feira" {
+		t.Errorf("got %q for Monday; want ours", got)
+	}
+
+	// anything a new locale leaves out is in English
+	if replies, err = config.Replies("fr"); err != nil {
+		t.Fatal(err)
+	}
+	if got := replies.Render(replyResumed, nil); got != "Bon retour !" {
+		t.Errorf("got %q; want the configured reply", got)
+	}
+	if got := replies.Render(replyNoStats, nil); got != UserNoStatsText {
+		t.Errorf("got %q; want it in English", got)
+	}
+	if got := replies.Day(time.Monday); got != "Monday" {
+		t.Errorf("got %q for Monday; want it in English", got)
+	}
+}
+
+func TestLocaleErrors(t *testing.T) {
+	tests := []Catalogue{
+		{Questions: []string{"Quoi ?"}},
+		{Templates: map[string]string{"thankyou": "Merci !"}},
+		{Templates: map[string]string{templateThanks: "{{.Merci"}},
+		{Replies: map[string]string{"welcome_back": "Bon retour !"}},
+		{Replies: map[string]string{replyResumed: "{{if}}"}},
+		{Days: []string{"lundi", "mardi"}},
+	}
+	for _, cat := range tests {
+		config := &Config{Locales: map[string]Catalogue{"fr": cat}}
+		if err := config.validate(); err == nil {
+			t.Errorf("validated %+v; want an error", cat)
+		}
+	}
+
+	config := &Config{}
+	if _, err := config.Replies("fr"); err == nil {
+		t.Error("got replies for a locale we don't have")
+	}
+}
+
+func TestFindLocale(t *testing.T) {
+	config := &Config{Locales: map[string]Catalogue{"fr": {Name: "Français"}}}
+	tests := map[string]string{
+		"pt":        "pt",
+		"PT":        "pt",
+		"pt-BR":     "pt",
+		"de_AT":     "de",
+		"Deutsch":   "de",
+		"português": "pt",
+		"français":  "fr",
+		"english":   "en",
+		"klingon":   "",
+	}
+	for ref, want := range tests {
+		if got, ok := config.FindLocale(ref); got != want || ok != (want != "") {
+			t.Errorf("FindLocale(%q) = %q, %t; want %q", ref, got, ok, want)
+		}
+	}
+	if got := config.DescribeLocales(); got != "Deutsch (`de`), English (`en`), Français (`fr`), Português (`pt`)" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestRepliesRender(t *testing.T) {
+	config := &Config{}
+	de, err := config.Replies("de")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := ParticipationStats{Asked: 4, Answered: 2, Partial: 1, Absent: 1, Streak: 2, LongestStreak: 3}
+	if got := stats.Describe(de); !strings.HasPrefix(got, "Du wurdest zu 4 Stand-ups gefragt und hast 75% davon beantwortet") {
+		t.Errorf("got %q", got)
+	}
+	if got := (ParticipationStats{}).Describe(de); got != builtinCatalogues["de"].Replies[replyNoStats] {
+		t.Errorf("got %q; want no stats, in German", got)
+	}
+
+	prefs := UserPreferences{OptedOut: []string{"C1"}, Weekdays: []time.Weekday{time.Monday, time.Friday}}
+	if got := prefs.Describe(builtinReplies); got != "You've opted out of <#C1>.\nI only ask you on Monday, Friday.\n" {
+		t.Errorf("got %q", got)
+	}
+	if got := (UserPreferences{}).Describe(de); got != builtinCatalogues["de"].Replies[replyNoPreferences] {
+		t.Errorf("got %q; want no preferences, in German", got)
+	}
+
+	// given the wrong data, we fall back on English, which doesn't need it
+	broken, err := parseReplies(map[string]string{replyResumed: "{{.Nope}}"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := broken.Render(replyResumed, replyData{}); got != UserResumedText {
+		t.Errorf("got %q; want ours", got)
+	}
+}
+
+func TestRepliesInTheirLanguage(t *testing.T) {
+	defer func(settings *Config) { Settings = settings }(Settings)
+	Settings = &Config{
+		Defaults: json.RawMessage(`{"locale": "pt"}`),
+		Channels: map[string]json.RawMessage{"berlin": json.RawMessage(`{"locale": "de"}`)},
+	}
+
+	b := newTestBot(t, slack.User{Id: "U1", Name: "bob"}, slack.User{Id: "U2", Name: "amy"})
+	defer b.Close()
+	b.users.preferences.Update("U2", func(p *UserPreferences) { p.Locale = "de" })
+
+	b.say("U1", "stats")
+	b.slack.waitForDM(t, "U1", builtinCatalogues["pt"].Replies[replyNoStats])
+	b.say("U2", "stats")
+	b.slack.waitForDM(t, "U2", builtinCatalogues["de"].Replies[replyNoStats])
+
+	berlin := testChannel("C1", "berlin", "U1")
+	b.slack.channels = []slack.Channel{berlin}
+	commands := NewChannelCommands(b.client, b.standups, b.users)
+	commands.Handle(mention(berlin, "U1", "<@UTILLY> hello"))
+	if posts := b.slack.ChannelPosts("C1"); len(posts) != 1 || posts[0].Text != builtinCatalogues["de"].Replies[replyMentionHelp] {
+		t.Errorf("got %v; want help, in German", posts)
+	}
+}
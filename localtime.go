@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/abourget/slack"
+	"time"
+)
+
+const localTimeFormat = "15:04"
+
+func userLocation(u slack.User) *time.Location {
+	if u.TZ != "" {
+		if loc, err := time.LoadLocation(u.TZ); err == nil {
+			return loc
+		}
+	}
+	return time.FixedZone(u.TZLabel, u.TZOffset)
+}
+
+/* localStartTime works out when to ask someone in loc, given a time of day
+ * like "09:30". That's today's, unless the window for answering today's has
+ * already closed, in which case it's tomorrow's.
+ */
+func localStartTime(clock string, loc *time.Location, now time.Time, window time.Duration) time.Time {
+	t, err := time.Parse(localTimeFormat, clock)
+	if err != nil {
+		return now
+	}
+
+	local := now.In(loc)
+	start := time.Date(local.Year(), local.Month(), local.Day(),
+		t.Hour(), t.Minute(), 0, 0, loc)
+	if !start.Add(window).After(now) {
+		start = start.AddDate(0, 0, 1)
+	}
+	return start
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/abourget/slack"
+	"testing"
+	"time"
+)
+
+func TestLocalStartTime(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	now := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC) // 17:00 in Tokyo
+
+	tests := []struct {
+		clock string
+		loc   *time.Location
+		want  time.Time
+	}{
+		{"09:30", time.UTC, time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)},
+		// we're still in today's window
+		{"07:45", time.UTC, time.Date(2026, 10, 19, 7, 45, 0, 0, time.UTC)},
+		// today's has closed
+		{"07:00", time.UTC, time.Date(2026, 10, 20, 7, 0, 0, 0, time.UTC)},
+		{"09:30", tokyo, time.Date(2026, 10, 20, 9, 30, 0, 0, tokyo)},
+		{"16:45", tokyo, time.Date(2026, 10, 19, 16, 45, 0, 0, tokyo)},
+		{"soon", time.UTC, now},
+	}
+	for _, test := range tests {
+		if got := localStartTime(test.clock, test.loc, now, 30*time.Minute); !got.Equal(test.want) {
+			t.Errorf("localStartTime(%s, %s) = %s; want %s", test.clock, test.loc, got, test.want)
+		}
+	}
+}
+
+func TestUserLocation(t *testing.T) {
+	if loc := userLocation(slack.User{TZ: "Europe/Lisbon"}); loc.String() != "Europe/Lisbon" {
+		t.Errorf("got %s; want Europe/Lisbon", loc)
+	}
+	// Slack's offset, when we don't know the name
+	loc := userLocation(slack.User{TZ: "Nowhere/Special", TZLabel: "Special Time", TZOffset: -3 * 60 * 60})
+	if _, offset := time.Date(2026, 10, 19, 0, 0, 0, 0, loc).Zone(); offset != -3*60*60 {
+		t.Errorf("got an offset of %d; want -3 hours", offset)
+	}
+}
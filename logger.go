@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+	levelFatal
+)
+
+var logLevelNames = []string{"debug", "info", "warn", "error", "fatal"}
+
+func (l logLevel) String() string {
+	return logLevelNames[l]
+}
+
+func parseLogLevel(name string) (logLevel, bool) {
+	for l, n := range logLevelNames {
+		if n == strings.ToLower(name) {
+			return logLevel(l), true
+		}
+	}
+	return levelInfo, false
+}
+
+/* Loggers carry fields, like the channel and stand-up or the user, that end
+ * up on every line they write, so that one person's conversation can be
+ * followed all the way through. Lines are JSON unless TILLY_LOG_FORMAT is
+ * text, and TILLY_LOG_LEVEL, or DEBUG for old times' sake, sets how much
+ * we say.
+ */
+type Logger struct {
+	fields []logField
+}
+
+type logField struct {
+	key   string
+	value interface{}
+}
+
+var Log = new(Logger)
+
+var logOutput = struct {
+	sync.Mutex
+	w     io.Writer
+	level logLevel
+	json  bool
+}{w: os.Stderr, level: levelInfo, json: true}
+
+func init() {
+	if os.Getenv("DEBUG") != "" {
+		logOutput.level = levelDebug
+	}
+	if name := os.Getenv("TILLY_LOG_LEVEL"); name != "" {
+		level, ok := parseLogLevel(name)
+		if !ok {
+			Log.Warnf("unknown TILLY_LOG_LEVEL %s; using info", name)
+		}
+		logOutput.level = level
+	}
+	logOutput.json = os.Getenv("TILLY_LOG_FORMAT") != "text"
+}
+
+func SetLogLevel(name string) error {
+	level, ok := parseLogLevel(name)
+	if !ok {
+		return fmt.Errorf("unknown log level %s", name)
+	}
+	logOutput.Lock()
+	defer logOutput.Unlock()
+	logOutput.level = level
+	return nil
+}
+
+func SetLogFormat(name string) error {
+	if name != "json" && name != "text" {
+		return fmt.Errorf("unknown log format %s", name)
+	}
+	logOutput.Lock()
+	defer logOutput.Unlock()
+	logOutput.json = name == "json"
+	return nil
+}
+
+// With returns a logger that adds a field to everything this one writes.
+func (self *Logger) With(key string, value interface{}) *Logger {
+	fields := make([]logField, len(self.fields), len(self.fields)+1)
+	copy(fields, self.fields)
+	return &Logger{fields: append(fields, logField{key, value})}
+}
+
+func (self *Logger) Debugf(format string, args ...interface{}) {
+	self.write(levelDebug, format, args)
+}
+
+func (self *Logger) Infof(format string, args ...interface{}) {
+	self.write(levelInfo, format, args)
+}
+
+func (self *Logger) Warnf(format string, args ...interface{}) {
+	self.write(levelWarn, format, args)
+}
+
+func (self *Logger) Errorf(format string, args ...interface{}) {
+	self.write(levelError, format, args)
+}
+
+func (self *Logger) Fatalf(format string, args ...interface{}) {
+	self.write(levelFatal, format, args)
+	os.Exit(1)
+}
+
+func (self *Logger) write(level logLevel, format string, args []interface{}) {
+	logOutput.Lock()
+	defer logOutput.Unlock()
+
+	if level < logOutput.level {
+		return
+	}
+
+	now := time.Now()
+	msg := fmt.Sprintf(format, args...)
+	caller := ""
+	if _, file, line, ok := runtime.Caller(2); ok {
+		caller = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
+
+	var line bytes.Buffer
+	if logOutput.json {
+		line.WriteString("{")
+		writeJSONField(&line, "time", now.Format(time.RFC3339Nano))
+		line.WriteString(",")
+		writeJSONField(&line, "level", level.String())
+		line.WriteString(",")
+		writeJSONField(&line, "msg", msg)
+		line.WriteString(",")
+		writeJSONField(&line, "caller", caller)
+		for _, f := range self.fields {
+			line.WriteString(",")
+			writeJSONField(&line, f.key, f.value)
+		}
+		line.WriteString("}\n")
+	} else {
+		fmt.Fprintf(&line, "%s %-5s %s: %s", now.Format("2006/01/02 15:04:05"),
+			level, caller, msg)
+		for _, f := range self.fields {
+			fmt.Fprintf(&line, " %s=%v", f.key, f.value)
+		}
+		line.WriteString("\n")
+	}
+	logOutput.w.Write(line.Bytes())
+}
+
+func writeJSONField(buf *bytes.Buffer, key string, value interface{}) {
+	k, _ := json.Marshal(key)
+	v, err := json.Marshal(value)
+	if err != nil {
+		v, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(k)
+	buf.WriteString(":")
+	buf.Write(v)
+}
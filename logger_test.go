@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// captureLog sends what's logged to a buffer, at a level and format, until
+// it's restored. Goroutines left over from other tests may log to it too.
+func captureLog(level logLevel, asJSON bool) (out *bytes.Buffer, restore func()) {
+	logOutput.Lock()
+	defer logOutput.Unlock()
+
+	w, oldLevel, oldJSON := logOutput.w, logOutput.level, logOutput.json
+	out = new(bytes.Buffer)
+	logOutput.w, logOutput.level, logOutput.json = out, level, asJSON
+	return out, func() {
+		logOutput.Lock()
+		defer logOutput.Unlock()
+		logOutput.w, logOutput.level, logOutput.json = w, oldLevel, oldJSON
+	}
+}
+
+// linesFrom are the lines a test logged, with its field.
+func linesFrom(out *bytes.Buffer, test string) (lines []string) {
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.Contains(line, test) {
+			lines = append(lines, line)
+		}
+	}
+	return
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for name, want := range map[string]logLevel{"debug": levelDebug, "WARN": levelWarn, "error": levelError} {
+		if got, ok := parseLogLevel(name); got != want || !ok {
+			t.Errorf("parseLogLevel(%q) = %s, %t; want %s", name, got, ok, want)
+		}
+	}
+	if got, ok := parseLogLevel("chatty"); got != levelInfo || ok {
+		t.Errorf("parseLogLevel(chatty) = %s, %t; want info, and that we didn't know it", got, ok)
+	}
+	if err := SetLogLevel("chatty"); err == nil {
+		t.Error("set the log level to chatty")
+	}
+	if err := SetLogFormat("xml"); err == nil {
+		t.Error("set the log format to xml")
+	}
+}
+
+func TestLogLevels(t *testing.T) {
+	out, restore := captureLog(levelWarn, false)
+	logger := Log.With("test", "TestLogLevels")
+	logger.Debugf("debug")
+	logger.Infof("info")
+	logger.Warnf("warn")
+	logger.Errorf("error")
+	restore()
+
+	lines := linesFrom(out, "test=TestLogLevels")
+	if len(lines) != 2 || !strings.Contains(lines[0], "warn ") || !strings.Contains(lines[1], "error ") {
+		t.Errorf("got %q; want only the warning and the error", lines)
+	}
+}
+
+func TestLogJSON(t *testing.T) {
+	out, restore := captureLog(levelDebug, true)
+	parent := Log.With("test", "TestLogJSON").With("channel_id", "C1")
+	child := parent.With("user_id", "U1")
+	child.Infof("asked %d questions", 3)
+	parent.Debugf("just the channel")
+	restore()
+
+	lines := linesFrom(out, `"test":"TestLogJSON"`)
+	if len(lines) != 2 {
+		t.Fatalf("got %q; want two lines", lines)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatalf("%s: %s", lines[0], err)
+	}
+	for key, want := range map[string]string{"level": "info", "msg": "asked 3 questions", "channel_id": "C1", "user_id": "U1"} {
+		if got[key] != want {
+			t.Errorf("got %s %v; want %q", key, got[key], want)
+		}
+	}
+	// where we logged it, not the logger
+	if caller, _ := got["caller"].(string); !strings.HasPrefix(caller, "logger_test.go:") {
+		t.Errorf("got caller %q; want this file", caller)
+	}
+	if _, ok := got["time"]; !ok {
+		t.Error("got no time")
+	}
+
+	// children's fields don't find their way back to their parents
+	got = nil
+	if err := json.Unmarshal([]byte(lines[1]), &got); err != nil {
+		t.Fatalf("%s: %s", lines[1], err)
+	}
+	if _, ok := got["user_id"]; ok || got["channel_id"] != "C1" {
+		t.Errorf("got %q; want the channel, but not the user", lines[1])
+	}
+}
@@ -1,13 +1,11 @@
 package main
 
 import (
+	"fmt"
 	"github.com/abourget/slack"
-	"io/ioutil"
-	"log"
-	"math/rand"
+	"net/http"
 	"os"
-	"sync"
-	"time"
+	"strings"
 )
 
 var Questions = []string{
@@ -19,15 +17,114 @@ var Questions = []string{
 
 const StandupTimeMinutes = 30
 
-var StandupNagMinuteDelays = []int{15, 25}
+// How many people we look up and ask at once when a stand-up starts.
+const StandupStartConcurrency = 10
 
-const UserStandupStartText = "*WOOF!* Stand-up for #%s starting.\nMessage me `skip` to duck out of this one."
+// People who join a channel mid-stand-up are only asked if there's at least
+// this long left.
+const StandupJoinMinimumMinutes = 5
+
+// Nag people this many minutes before their deadline, unless a channel says
+// otherwise.
+var StandupNagMinutesBeforeEnd = []int{10, 2}
+
+// Don't nag anyone who's typing to us, or who's answered in the last minute.
+const StandupNagTypingWithinSeconds = 10
+const StandupNagAnsweredWithinMinutes = 1
+
+// What we say to people about stand-ups, and the summary, are templates that
+// channels can override; see templates.go.
+const UserStandupStartText = "*WOOF!* Stand-up for #{{.Channel}} starting.\nMessage me `skip` to duck out of this one."
 const UserStandupEndText = "Thanks! All done."
 const UserStandupTimeUpText = "Too slow! The stand-up's finished now. Catch up in the channel."
-const UserStandupAlreadyFinishedText = "Your next standup would have been for #%s but it's already finished. Catch up in the channel."
+const UserStandupEndedEarlyText = "The stand-up's been wrapped up early, sorry! Catch up in the channel."
+const UserStandupCancelledText = "Never mind, the stand-up's been cancelled."
+const UserStandupInterruptedText = "Sorry, I have to go! I'll post what you've told me so far in #{{.Channel}}."
+const UserLeftChannelText = "You've left #{{.Channel}}, so never mind that stand-up."
+const UserStandupAlreadyFinishedText = "Your next standup would have been for #{{.Channel}} but it's already finished. Catch up in the channel."
 const UserNextStandupText = "But wait, you have another stand-up to attend…"
 const UserConfirmSkipText = "Okay!"
 
+const SummaryText = `{{if not .Final}}*Stand-up in progress!* I'll update this as people finish.
+Questions are:
+{{else if .Interrupted}}<!here>: *Stand-up interrupted!* I had to stop early, so this is what I got.
+Questions were:
+{{else}}<!here>: *BARKBARKBARK Stand-up done!*
+Questions were:
+{{end}}{{range .Questions}}• {{.}}
+{{end}}
+{{range .Sections}}{{.}}{{end}}`
+const SummaryAnsweredText = `{{.User}} answered{{with .Took}} in {{.}}{{end}}:
+{{range .Answers}}• {{.}}
+{{end}}{{if .Partial}}but didn't respond to the rest.
+{{end}}
+`
+const SummaryAbsentText = "{{.User}} {{if .Interrupted}}hadn't replied yet.{{else}}never replied to me :disappointed:{{end}}\n"
+const SummarySkippedText = "{{.User}} skipped this stand-up.\n"
+const SummaryErrorText = "There was an error when trying to chat with {{.User}}\n"
+const SummaryOnLeaveText = "{{.User}} is on leave.\n"
+const SummaryAwayText = "{{.User}} is away.\n"
+const SummaryExcludedText = "{{.User}} wasn't asked: {{.Reason}}.\n"
+const AttachmentsHeadingText = "{{if not .Final}}*Stand-up in progress!* I'll update this as people finish.{{else if .Interrupted}}<!here>: *Stand-up interrupted!* I had to stop early, so this is what I got.{{else}}<!here>: *BARKBARKBARK Stand-up done!*{{end}}"
+const AttachmentsPartialText = "Didn't respond to the rest."
+const AttachmentsFooterText = `{{if .Absent}}{{if .Interrupted}}Hadn't replied yet{{else}}Never replied{{end}}: {{join .Absent ", "}}. {{end}}{{if .Skipped}}Skipped: {{join .Skipped ", "}}. {{end}}{{if .Errors}}Couldn't chat with: {{join .Errors ", "}}. {{end}}{{if .OnLeave}}On leave: {{join .OnLeave ", "}}. {{end}}{{if .Away}}Away: {{join .Away ", "}}. {{end}}{{if .Excluded}}Not asked: {{join .Excluded ", "}}.{{end}}`
+const SummaryStreakText = ":fire: {{.User}} has answered {{.Days}} days in a row"
+
+// What we reply to commands, in channels and DMs, are templates too, which
+// locales can translate; see replies.go.
+const AdminStartedText = "Okay, starting a stand-up in #{{.Channel}}."
+const AdminEndedText = "Okay, I've wrapped up #{{.Channel}} and posted the summary."
+const AdminCancelledText = "Okay, I've cancelled the stand-up in #{{.Channel}}."
+const AdminExtendedText = "Okay, #{{.Channel}} now ends at {{.Ends.Format \"15:04\"}}."
+const AdminAlreadyRunningText = "There's already a stand-up running in #{{.Channel}}."
+const AdminNotRunningText = "There's no stand-up running in #{{.Channel}}."
+const AdminNothingRunningText = "There are no stand-ups running."
+const AdminShuttingDownText = "I'm shutting down, so I can't start a stand-up in #{{.Channel}}."
+const AdminNotMemberText = "I'm not in #{{.Channel}}, invite me first."
+const AdminUnknownChannelText = "I can't find a channel called {{.Channel}}."
+const AdminChannelErrorText = "Sorry, something went wrong looking up {{.Channel}}."
+const AdminStatusText = `*#{{.Channel}}*, started {{.Started.Format "15:04"}}, ends {{.Ends.Format "15:04"}}:
+{{range .People}}• {{.User}} {{if .Absent}}hasn't replied yet{{else if .Skipped}}skipped{{else if .Error}}couldn't be reached{{else}}has answered {{.Answered}} of {{.Questions}}{{end}}
+{{else}}Nobody's been asked yet.
+{{end}}`
+const MentionStartedText = "*WOOF!* Starting a stand-up, check your DMs."
+const MentionAlreadyRunningText = "There's already a stand-up running in here."
+const MentionShuttingDownText = "I'm shutting down, so I can't start a stand-up right now."
+const MentionNotRunningText = "There's no stand-up running in here right now."
+const MentionSkippedText = "Okay {{.User}}, you're skipping this one."
+const MentionNotAskedText = "{{.User}}, there's nothing for you to skip: I haven't asked you to this stand-up, or you've already finished."
+const MentionMissingText = "Still waiting on {{join .Users \", \"}}."
+const MentionNobodyMissingText = "Nobody! Everyone's answered."
+const MentionErrorText = "Sorry, something went wrong there."
+const MentionHelpText = "Mention me with `standup now` to start a stand-up in here, `skip today` to skip it, or `who's missing?` to see who hasn't answered yet."
+const UserNoPreferencesText = "I ask you to every stand-up in the channels you're in."
+const UserPreferencesText = `{{if .Paused}}You're paused until {{.Until.Format "2006-01-02"}}.
+{{end}}{{with .OptedOut}}You've opted out of {{join . ", "}}.
+{{end}}{{with .Weekdays}}I only ask you on {{join . ", "}}.
+{{end}}{{with .Language}}I ask you in {{.}}.
+{{end}}`
+const UserPreferencesErrorText = "Sorry, I couldn't save that."
+const UserBadDateText = "I need dates like 2026-11-02."
+const UserPausedText = "Okay, I won't ask you to any stand-ups until {{.Until.Format \"Monday 2 January\"}}. Enjoy!"
+const UserResumedText = "Welcome back!"
+const UserOptedOutText = "Okay, I won't ask you to stand-ups in #{{.Channel}} any more."
+const UserOptedInText = "Okay, I'll ask you to stand-ups in #{{.Channel}} again."
+const UserWeekdaysText = "Okay, I'll only ask you on those days."
+const UserEveryDayText = "Okay, I'll ask you every day."
+const UserLanguageText = "Okay, I'll ask you in {{.Language}} from now on."
+const UserDefaultLanguageText = "Okay, I'll ask you in each channel's own language."
+const UserUnknownLanguageText = "I don't speak {{.Language}}. I can do {{.Languages}}."
+const UserNoStatsText = "I haven't asked you to any stand-ups yet."
+const UserStatsText = `You've been asked to {{.Asked}} stand-ups and answered {{.Rate}}% of them ({{.Answered}} in full, {{.Partial}} partly, {{.Skipped}} skipped, {{.Missed}} missed).
+{{with .Average}}You take {{.}} to finish on average.
+{{end}}Your current streak is {{.Streak}} days, and your best is {{.LongestStreak}}.`
+const UserSnoozedText = "Okay, no more reminders about this one."
+const UserSnoozedForText = "Okay, no reminders for {{.Minutes}} minutes."
+
+// Mention people in the summary once their streak reaches this many days.
+// Zero turns the streak footer off.
+var SummaryStreakMinimum = 0
+
 var UserNagMessages = []string{
 	"Don't forget to answer me!",
 }
@@ -45,70 +142,25 @@ var DefaultMessageParameters = slack.PostMessageParameters{
 type AuthedSlack struct {
 	*slack.Client
 	UserId string
-}
-
-var DebugLog *log.Logger
-
-func init() {
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
-
-	if os.Getenv("DEBUG") != "" {
-		DebugLog = log.New(os.Stderr, "debug: ", log.LstdFlags|log.Lshortfile)
-	} else {
-		DebugLog = log.New(ioutil.Discard, "", 0)
-	}
+	Token  string
 }
 
 func main() {
-	var err error
-
-	slackToken := os.Getenv("SLACK_TOKEN")
-	if slackToken == "" {
-		log.Fatalln("You must provide a SLACK_TOKEN environment variable")
-	}
-
-	if day := time.Now().Weekday(); os.Getenv("TILLY_WEEKDAY_ONLY") != "" && (day < time.Monday || day > time.Friday) {
-		log.Fatalln("Exiting; it's the weekend and I'm set to only run on a weekday")
-	}
-
-	client := slack.New(slackToken)
-
-	auth, err := client.AuthTest()
-	if err != nil {
-		log.Fatalf("Couldn't log in: %s", err)
+	args := os.Args[1:]
+	command := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
 	}
-	authClient := &AuthedSlack{Client: client, UserId: auth.UserId}
-
-	slackWS := authClient.NewRTM()
-	userManager := NewUserManager(authClient)
-	eventReceiver := NewEventReceiver(slackWS, userManager, auth.UserId)
-	go eventReceiver.Start()
 
-	chs, err := authClient.GetChannels(true)
-	if err != nil {
-		log.Fatalf("Couldn't get channels: %s", err)
+	run, ok := commands[command]
+	if !ok {
+		fmt.Fprint(os.Stderr, usageText)
+		os.Exit(2)
 	}
-
-	exitWaitGroup := new(sync.WaitGroup)
-
-	for _, ch := range chs {
-		if ch.IsGeneral || !ch.IsMember {
-			continue
-		}
-
-		s := NewStandup(authClient, ch, userManager, exitWaitGroup)
-		go s.Run()
-	}
-
-	exitWaitGroup.Wait()
+	run(args)
 }
 
-func RandomisedNags() (out []string) {
-	out = make([]string, len(UserNagMessages))
-	copy(out, UserNagMessages)
-	for i := range out {
-		j := rand.Intn(i + 1)
-		out[i], out[j] = out[j], out[i]
-	}
-	return
+func serveMetrics(addr string) {
+	Log.Infof("Serving metrics on %s", addr)
+	Log.Fatalf("%s", http.ListenAndServe(addr, NewMetricsHandler()))
 }
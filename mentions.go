@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"github.com/abourget/slack"
+	"strings"
+)
+
+var mentionStartCommands = map[string]bool{
+	"standup":          true,
+	"standup now":      true,
+	"stand-up":         true,
+	"stand-up now":     true,
+	"start":            true,
+	"start standup":    true,
+	"start a standup":  true,
+	"start stand-up":   true,
+	"start a stand-up": true,
+}
+
+var mentionSkipCommands = map[string]bool{
+	"skip":       true,
+	"skip today": true,
+	"skip me":    true,
+}
+
+var mentionMissingCommands = map[string]bool{
+	"who's missing":  true,
+	"who’s missing":  true,
+	"whos missing":   true,
+	"who is missing": true,
+	"missing":        true,
+}
+
+/* ChannelCommands handles messages in channels that mention Tilly, like
+ * "@tilly standup now". They're scoped to the channel they're said in.
+ */
+type ChannelCommands struct {
+	client      *AuthedSlack
+	standups    *StandupManager
+	userManager *UserManager
+	botUserId   string
+}
+
+func NewChannelCommands(client *AuthedSlack, standups *StandupManager, um *UserManager) *ChannelCommands {
+	return &ChannelCommands{
+		client:      client,
+		standups:    standups,
+		userManager: um,
+		botUserId:   client.UserId,
+	}
+}
+
+func (self *ChannelCommands) Mentioned(m slack.MessageEvent) bool {
+	return strings.Contains(m.Text, "<@"+self.botUserId+">") ||
+		strings.Contains(m.Text, "<@"+self.botUserId+"|")
+}
+
+func (self *ChannelCommands) Handle(m slack.MessageEvent) {
+	cmd := self.parseMention(m.Text)
+	Log.With("channel_id", m.ChannelId).With("user_id", m.UserId).Debugf("got command '%s'", cmd)
+
+	switch {
+	case mentionStartCommands[cmd]:
+		self.start(m)
+	case mentionSkipCommands[cmd]:
+		self.skip(m)
+	case mentionMissingCommands[cmd]:
+		self.missing(m)
+	default:
+		self.reply(m, replyMentionHelp, nil)
+	}
+}
+
+// parseMention strips out the mention of us and any punctuation around it,
+// leaving a normalised command.
+func (self *ChannelCommands) parseMention(text string) string {
+	words := make([]string, 0)
+	for _, w := range strings.Fields(text) {
+		if strings.HasPrefix(w, "<@"+self.botUserId) {
+			continue
+		}
+		w = strings.Trim(w, ".,:;!?")
+		if w != "" {
+			words = append(words, w)
+		}
+	}
+	return normaliseCommand(strings.Join(words, " "))
+}
+
+func (self *ChannelCommands) start(m slack.MessageEvent) {
+	ch, err := self.client.GetChannelInfo(m.ChannelId)
+	if err != nil {
+		Log.With("channel_id", m.ChannelId).Errorf("error getting channel info: %s", err)
+		self.reply(m, replyMentionError, nil)
+		return
+	}
+
+	if _, err = self.standups.Start(*ch); err == errStandupAlreadyRunning {
+		self.reply(m, replyMentionAlreadyRunning, nil)
+	} else if err == errShuttingDown {
+		self.reply(m, replyMentionShuttingDown, nil)
+	} else if err != nil {
+		Log.With("channel_id", m.ChannelId).Errorf("error starting stand-up: %s", err)
+		self.reply(m, replyMentionError, nil)
+	} else {
+		self.reply(m, replyMentionStarted, nil)
+	}
+}
+
+func (self *ChannelCommands) skip(m slack.MessageEvent) {
+	s := self.standups.Running(m.ChannelId)
+	if s == nil {
+		self.reply(m, replyMentionNotRunning, nil)
+		return
+	}
+	if self.userManager.SkipStandup(s, m.UserId) {
+		self.reply(m, replyMentionSkipped, replyData{User: "<@" + m.UserId + ">"})
+	} else {
+		self.reply(m, replyMentionNotAsked, replyData{User: "<@" + m.UserId + ">"})
+	}
+}
+
+func (self *ChannelCommands) missing(m slack.MessageEvent) {
+	s := self.standups.Running(m.ChannelId)
+	if s == nil {
+		self.reply(m, replyMentionNotRunning, nil)
+		return
+	}
+
+	missing := s.Missing()
+	if len(missing) == 0 {
+		self.reply(m, replyMentionNobodyMissing, nil)
+		return
+	}
+	names := make([]string, len(missing))
+	for i, u := range missing {
+		names[i] = fmt.Sprintf("<@%s|%s>", u.Info().Id, u.Info().Name)
+	}
+	self.reply(m, replyMentionMissing, replyData{Users: names})
+}
+
+func (self *ChannelCommands) reply(m slack.MessageEvent, name string, data interface{}) {
+	text := self.replies(m.ChannelId).Render(name, data)
+	_, _, err := self.client.PostMessage(m.ChannelId, text, channelMessageParameters())
+	if err != nil {
+		Log.With("channel_id", m.ChannelId).Errorf("error replying: %s", err)
+	}
+}
+
+// replies are in the channel's language.
+func (self *ChannelCommands) replies(channelId string) *Replies {
+	locale := Settings.DefaultLocale()
+	if s := self.standups.Running(channelId); s != nil {
+		locale = s.config.Locale
+	} else if ch, err := self.client.GetChannelInfo(channelId); err == nil {
+		locale = Settings.Channel(*ch).Locale
+	}
+	replies, err := Settings.Replies(locale)
+	if err != nil {
+		Log.With("channel_id", channelId).Errorf("error using locale %s; replying in English: %s", locale, err)
+		return builtinReplies
+	}
+	return replies
+}
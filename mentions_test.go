@@ -0,0 +1,116 @@
+package main
+
+import (
+	"github.com/abourget/slack"
+	"testing"
+)
+
+func mention(ch slack.Channel, userId, text string) slack.MessageEvent {
+	return slack.MessageEvent{Msg: slack.Msg{ChannelId: ch.Id, UserId: userId, Text: text}}
+}
+
+func TestParseMention(t *testing.T) {
+	cc := &ChannelCommands{botUserId: "UTILLY"}
+	tests := map[string]string{
+		"<@UTILLY> standup now":          "standup now",
+		"<@UTILLY|tilly>: Skip today!":   "skip today",
+		"hey <@UTILLY>, who's missing?":  "hey who's missing",
+		"<@UTILLY>   Who is   missing ?": "who is missing",
+	}
+	for text, want := range tests {
+		if got := cc.parseMention(text); got != want {
+			t.Errorf("parseMention(%q) = %q; want %q", text, got, want)
+		}
+	}
+}
+
+func TestMentionSkip(t *testing.T) {
+	b := newTestBot(t,
+		slack.User{Id: "U1", Name: "bob"},
+		slack.User{Id: "U2", Name: "amy"},
+		slack.User{Id: "U3", Name: "cat"},
+		slack.User{Id: "U4", Name: "dan"})
+	defer b.Close()
+	commands := NewChannelCommands(b.client, b.standups, b.users)
+
+	// dan keeps it going
+	ch := testChannel("C1", "design", "U1", "U2", "U4")
+	s := b.start(t, ch, "U1", "U2", "U4")
+	for _, q := range Questions {
+		b.say("U1", q)
+	}
+	b.slack.waitForDM(t, "U1", UserStandupEndText)
+
+	replies := func() (texts []string) {
+		for _, p := range b.slack.ChannelPosts(ch.Id) {
+			texts = append(texts, p.Text)
+		}
+		return
+	}
+	tests := []struct {
+		userId string
+		want   string
+	}{
+		{"U2", builtinReplies.Render(replyMentionSkipped, replyData{User: "<@U2>"})},
+		// they'd finished already
+		{"U1", builtinReplies.Render(replyMentionNotAsked, replyData{User: "<@U1>"})},
+		// we never asked them
+		{"U3", builtinReplies.Render(replyMentionNotAsked, replyData{User: "<@U3>"})},
+		// they skipped already
+		{"U2", builtinReplies.Render(replyMentionNotAsked, replyData{User: "<@U2>"})},
+	}
+	for i, test := range tests {
+		commands.Handle(mention(ch, test.userId, "<@UTILLY> skip today"))
+		if got := replies(); len(got) != i+1 || got[i] != test.want {
+			t.Fatalf("%s skipping: got %q; want %q", test.userId, got, test.want)
+		}
+	}
+
+	s.End()
+	b.waitReported(t)
+	rec := s.record()
+	for _, p := range rec.Participants {
+		if want := map[string]string{"U1": participantAnswered, "U2": participantSkipped, "U4": participantAbsent}[p.UserId]; p.Status != want {
+			t.Errorf("%s %s; want %s", p.Name, p.Status, want)
+		}
+	}
+}
+
+func TestMentionMissing(t *testing.T) {
+	b := newTestBot(t,
+		slack.User{Id: "U1", Name: "dan"},
+		slack.User{Id: "U2", Name: "amy"},
+		slack.User{Id: "U3", Name: "cat"},
+		slack.User{Id: "U4", Name: "bob"})
+	defer b.Close()
+	commands := NewChannelCommands(b.client, b.standups, b.users)
+
+	ch := testChannel("C1", "design", "U1", "U2", "U3", "U4")
+	commands.Handle(mention(ch, "U1", "<@UTILLY> who's missing?"))
+	s := b.start(t, ch, "U1", "U2", "U3", "U4")
+	// cat's done, and amy's started
+	for _, q := range Questions {
+		b.say("U3", q)
+	}
+	b.slack.waitForDM(t, "U3", UserStandupEndText)
+	b.say("U2", "Answer")
+	b.slack.waitForDM(t, "U2", Questions[1])
+
+	// by name, whichever way round they're kept
+	for i := 0; i < 10; i++ {
+		commands.Handle(mention(ch, "U1", "<@UTILLY> who's missing?"))
+	}
+	want := builtinReplies.Render(replyMentionMissing, replyData{Users: []string{"<@U2|amy>", "<@U4|bob>", "<@U1|dan>"}})
+	posts := b.slack.ChannelPosts(ch.Id)
+	if len(posts) != 11 || posts[0].Text != MentionNotRunningText {
+		t.Fatalf("got %v; want to hear nothing's running, then who's missing", posts)
+	}
+	for _, p := range posts[1:] {
+		if p.Text != want {
+			t.Errorf("got %q; want %q", p.Text, want)
+		}
+	}
+
+	s.End()
+	b.waitReported(t)
+}
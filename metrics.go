@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* Metrics are served in Prometheus's text format. We've only a handful, so
+ * rather than pull in the client library we keep them ourselves: each is a
+ * counter or gauge with at most one label.
+ */
+type metric struct {
+	name   string
+	help   string
+	kind   string
+	label  string
+	values map[string]float64
+	mutex  sync.Mutex
+}
+
+var allMetrics []*metric
+
+func newMetric(kind, name, help, label string) *metric {
+	m := &metric{name: name, help: help, kind: kind, label: label,
+		values: make(map[string]float64)}
+	if label == "" {
+		// unlabelled metrics are always there, even at zero
+		m.values[""] = 0
+	}
+	allMetrics = append(allMetrics, m)
+	return m
+}
+
+var (
+	metricStandupsStarted = newMetric("counter", "tilly_standups_started_total",
+		"Stand-ups started.", "")
+	metricStandupsFinished = newMetric("counter", "tilly_standups_finished_total",
+		"Stand-ups finished, by why they finished.", "reason")
+	metricSummariesPosted = newMetric("counter", "tilly_summaries_posted_total",
+		"Stand-up summaries posted to their channels.", "")
+	metricSummaryErrors = newMetric("counter", "tilly_summary_errors_total",
+		"Stand-up summaries we couldn't post.", "")
+	metricLastSummary = newMetric("gauge", "tilly_last_summary_posted_timestamp_seconds",
+		"When we last posted a stand-up summary.", "")
+	metricReplies = newMetric("counter", "tilly_replies_total",
+		"Replies from people to stand-ups, by type.", "type")
+	metricDMsSent = newMetric("counter", "tilly_dms_sent_total",
+		"Direct messages sent.", "")
+	metricSlackErrors = newMetric("counter", "tilly_slack_api_errors_total",
+		"Failed Slack API calls, by method.", "method")
+	metricSlackRetries = newMetric("counter", "tilly_slack_api_retries_total",
+		"Slack API calls we've retried, by method.", "method")
+	metricRTMReconnects = newMetric("counter", "tilly_rtm_reconnects_total",
+		"Times we've reconnected to the Slack RTM API.", "")
+	metricRTMConnected = newMetric("gauge", "tilly_rtm_connected",
+		"Whether we're connected to the Slack RTM API.", "")
+	metricUserGoroutines = newMetric("gauge", "tilly_user_goroutines",
+		"People we've looked up whose goroutines are running.", "")
+)
+
+func (self *metric) Add(labelValue string, n float64) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.values[labelValue] += n
+}
+
+func (self *metric) Inc(labelValue string) {
+	self.Add(labelValue, 1)
+}
+
+func (self *metric) Set(labelValue string, v float64) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.values[labelValue] = v
+}
+
+func (self *metric) writeTo(w io.Writer) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", self.name, self.help, self.name, self.kind)
+	labelValues := make([]string, 0, len(self.values))
+	for lv := range self.values {
+		labelValues = append(labelValues, lv)
+	}
+	sort.Strings(labelValues)
+	for _, lv := range labelValues {
+		if self.label == "" {
+			fmt.Fprintf(w, "%s %g\n", self.name, self.values[lv])
+		} else {
+			fmt.Fprintf(w, "%s{%s=\"%s\"} %g\n", self.name, self.label,
+				escapeLabelValue(lv), self.values[lv])
+		}
+	}
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(s string) string {
+	return labelValueEscaper.Replace(s)
+}
+
+/* RTM connection state is kept for /healthz, which is all a load balancer
+ * or uptime check needs to know about us.
+ */
+var rtmState = struct {
+	sync.Mutex
+	state string
+	since time.Time
+}{state: "connecting", since: time.Now()}
+
+func setRTMState(state string) {
+	rtmState.Lock()
+	defer rtmState.Unlock()
+	rtmState.state, rtmState.since = state, time.Now()
+	if state == "connected" {
+		metricRTMConnected.Set("", 1)
+	} else {
+		metricRTMConnected.Set("", 0)
+	}
+}
+
+func NewMetricsHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		for _, m := range allMetrics {
+			m.writeTo(w)
+		}
+	})
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		rtmState.Lock()
+		state, since := rtmState.state, rtmState.since
+		rtmState.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if state != "connected" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"rtm":   state,
+			"since": since.Format(time.RFC3339),
+		})
+	})
+
+	return mux
+}
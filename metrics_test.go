@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"github.com/abourget/slack"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func metricValue(m *metric, labelValue string) float64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.values[labelValue]
+}
+
+func TestMetricWriteTo(t *testing.T) {
+	m := &metric{name: "tilly_test_total", help: "Tests.", kind: "counter", label: "method",
+		values: make(map[string]float64)}
+	m.Inc("chat.postMessage")
+	m.Add("im.open", 2)
+	m.Inc(`a "quoted" \ method`)
+
+	var out bytes.Buffer
+	m.writeTo(&out)
+	want := `# HELP tilly_test_total Tests.
+# TYPE tilly_test_total counter
+tilly_test_total{method="a \"quoted\" \\ method"} 1
+tilly_test_total{method="chat.postMessage"} 1
+tilly_test_total{method="im.open"} 2
+`
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestMetricUserGoroutines(t *testing.T) {
+	b := newTestBot(t, slack.User{Id: "U1", Name: "bob"}, slack.User{Id: "U2", Name: "amy"})
+	defer b.Close()
+	before := metricValue(metricUserGoroutines, "")
+
+	// the first time we hear from someone, we start them a goroutine
+	b.say("U1", "stats")
+	b.slack.waitForDM(t, "U1", UserNoStatsText)
+	b.say("U1", "stats")
+	b.say("U2", "stats")
+	b.slack.waitForDM(t, "U2", UserNoStatsText)
+	if got := metricValue(metricUserGoroutines, ""); got != before+2 {
+		t.Errorf("got %g user goroutines; want %g", got, before+2)
+	}
+
+	w := httptest.NewRecorder()
+	NewMetricsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(w.Body.String(), "# TYPE tilly_user_goroutines gauge\n") {
+		t.Errorf("got:\n%s\nwant the user goroutines as a gauge", w.Body.String())
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	defer setRTMState("connecting")
+	handler := NewMetricsHandler()
+
+	tests := []struct {
+		state string
+		code  int
+	}{
+		{"connected", http.StatusOK},
+		{"disconnected", http.StatusServiceUnavailable},
+	}
+	for _, test := range tests {
+		setRTMState(test.state)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+		if w.Code != test.code || !strings.Contains(w.Body.String(), `"rtm":"`+test.state+`"`) {
+			t.Errorf("%s: got %d %s; want %d", test.state, w.Code, w.Body.String(), test.code)
+		}
+	}
+	if got := metricValue(metricRTMConnected, ""); got != 0 {
+		t.Errorf("got tilly_rtm_connected %g once we'd gone; want 0", got)
+	}
+}
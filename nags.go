@@ -0,0 +1,129 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* Nags are set by the channel's nag_minutes_before_end, relative to each
+ * person's own deadline, so they always come before it however long the
+ * stand-up is, whenever they were asked and however it's been extended. We
+ * only set a timer for the next one, and check it's still due when it goes
+ * off. Nags are held back from anyone who's snoozed them, or who's in the
+ * middle of answering: typing, or having answered in the last minute.
+ */
+
+const userSnoozeCommand = "snooze"
+
+// nagTime is when the nth nag is due, or zero if there isn't one.
+func (self *User) nagTime(s *Standup, n int) time.Time {
+	minutes := append([]int(nil), s.config.NagMinutesBeforeEnd...)
+	sort.Sort(sort.Reverse(sort.IntSlice(minutes)))
+	if n >= len(minutes) {
+		return time.Time{}
+	}
+	return s.DeadlineFor(self).Add(-time.Duration(minutes[n]) * time.Minute)
+}
+
+// scheduleNag sets a timer for the next nag that's still to come, skipping
+// any that were due before we asked.
+// Only for the user's own goroutine.
+func (self *User) scheduleNag() {
+	self.stopNag()
+	s := self.currentStandup
+	if s == nil {
+		return
+	}
+	now := time.Now()
+	for ; ; self.nagsSent++ {
+		at := self.nagTime(s, self.nagsSent)
+		if at.IsZero() {
+			return
+		}
+		if at.After(now) {
+			self.nagTimer = time.AfterFunc(at.Sub(now), func() {
+				self.events <- userNag{standup: s}
+			})
+			return
+		}
+	}
+}
+
+func (self *User) stopNag() {
+	if self.nagTimer != nil {
+		self.nagTimer.Stop()
+		self.nagTimer = nil
+	}
+}
+
+// Only for the user's own goroutine.
+func (self *User) handleNag(s *Standup) {
+	if s != self.currentStandup {
+		return
+	}
+	self.nagTimer = nil
+	if time.Now().Before(self.nagTime(s, self.nagsSent)) {
+		// the deadline's been pushed back
+		self.scheduleNag()
+		return
+	}
+
+	if reason, held := self.nagHeldBack(time.Now()); held {
+		self.standupLogger().Debugf("not nagging: %s", reason)
+	} else {
+		self.sendIM(s.NagText(self.locale(), self.nagMessageIdx))
+		self.nagMessageIdx++
+	}
+	self.nagsSent++
+	self.scheduleNag()
+}
+
+func (self *User) nagHeldBack(now time.Time) (reason string, held bool) {
+	switch {
+	case now.Before(self.snoozedUntil):
+		return "snoozed", true
+	case now.Sub(self.lastTyped) < StandupNagTypingWithinSeconds*time.Second:
+		return "typing", true
+	case now.Sub(self.lastAnswered) < StandupNagAnsweredWithinMinutes*time.Minute:
+		return "just answered", true
+	}
+	return "", false
+}
+
+// parseSnooze reads "snooze", for no more nags about the current stand-up,
+// when minutes is zero, or "snooze 10m", for none for 10 minutes. Nothing
+// else is a snooze, since it might well be an answer.
+func parseSnooze(cmd string) (minutes int, ok bool) {
+	words := strings.Fields(cmd)
+	if len(words) == 0 || words[0] != userSnoozeCommand || len(words) > 2 {
+		return 0, false
+	}
+	if len(words) == 1 {
+		return 0, true
+	}
+	if !strings.HasSuffix(words[1], "m") {
+		return 0, false
+	}
+	minutes, err := strconv.Atoi(strings.TrimSuffix(words[1], "m"))
+	if err != nil || minutes <= 0 || strings.HasPrefix(words[1], "+") {
+		return 0, false
+	}
+	return minutes, true
+}
+
+func (self *User) handleSnoozeCommand(cmd string) bool {
+	minutes, ok := parseSnooze(cmd)
+	if !ok {
+		return false
+	}
+	if minutes == 0 {
+		self.snoozedUntil = self.currentStandup.DeadlineFor(self)
+		self.sendIM(self.replyText(replySnoozed, nil))
+		return true
+	}
+	self.snoozedUntil = time.Now().Add(time.Duration(minutes) * time.Minute)
+	self.sendIM(self.replyText(replySnoozedFor, replyData{Minutes: minutes}))
+	return true
+}
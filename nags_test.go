@@ -0,0 +1,129 @@
+package main
+
+import (
+	"github.com/abourget/slack"
+	"testing"
+	"time"
+)
+
+func TestParseSnooze(t *testing.T) {
+	tests := []struct {
+		cmd     string
+		minutes int
+		ok      bool
+	}{
+		{"snooze", 0, true},
+		{"snooze 10m", 10, true},
+		{"snooze  90m", 90, true},
+		// things people might answer with
+		{"snooze 10", 0, false},
+		{"snooze 10 min", 0, false},
+		{"snooze 10mins", 0, false},
+		{"snooze 0m", 0, false},
+		{"snooze -5m", 0, false},
+		{"snooze +5m", 0, false},
+		{"snooze button", 0, false},
+		{"snoozed through my alarm", 0, false},
+		{"", 0, false},
+	}
+	for _, test := range tests {
+		if minutes, ok := parseSnooze(test.cmd); minutes != test.minutes || ok != test.ok {
+			t.Errorf("parseSnooze(%q) = %d, %t; want %d, %t", test.cmd, minutes, ok, test.minutes, test.ok)
+		}
+	}
+}
+
+func TestNagTime(t *testing.T) {
+	started := time.Now().Add(-25 * time.Minute)
+	late := &User{info: slack.User{Id: "U2"}}
+	s := &Standup{
+		Duration:     30 * time.Minute,
+		config:       ChannelConfig{NagMinutesBeforeEnd: []int{2, 10}},
+		clockStarted: started,
+		startsAt:     map[*User]time.Time{late: started.Add(time.Hour)},
+	}
+	u := &User{info: slack.User{Id: "U1"}, events: make(chan userEvent, 1)}
+
+	// the furthest from the deadline first, whichever way round they're given
+	for n, want := range []time.Time{started.Add(20 * time.Minute), started.Add(28 * time.Minute), {}} {
+		if got := u.nagTime(s, n); !got.Equal(want) {
+			t.Errorf("nag %d at %s; want %s", n, got, want)
+		}
+	}
+	// relative to their own deadline
+	if got, want := late.nagTime(s, 0), started.Add(80*time.Minute); !got.Equal(want) {
+		t.Errorf("nag at %s for someone asked later; want %s", got, want)
+	}
+	s.extension = 5 * time.Minute
+	if got, want := u.nagTime(s, 0), started.Add(25*time.Minute); !got.Equal(want) {
+		t.Errorf("nag at %s once extended; want %s", got, want)
+	}
+
+	// the first's gone, so only the second's to come
+	s.extension = 0
+	u.currentStandup = s
+	u.scheduleNag()
+	defer u.stopNag()
+	if u.nagsSent != 1 || u.nagTimer == nil {
+		t.Errorf("%d nags sent and timer %v; want the first skipped and the second set", u.nagsSent, u.nagTimer)
+	}
+
+	// and once they're all gone, there's nothing
+	s.clockStarted = started.Add(-time.Hour)
+	u.nagsSent = 0
+	u.scheduleNag()
+	if u.nagsSent != 2 || u.nagTimer != nil {
+		t.Errorf("%d nags sent and timer %v after the deadline; want nothing set", u.nagsSent, u.nagTimer)
+	}
+}
+
+func TestNagHeldBack(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		user   *User
+		reason string
+	}{
+		{&User{}, ""},
+		{&User{snoozedUntil: now.Add(time.Minute)}, "snoozed"},
+		{&User{snoozedUntil: now.Add(-time.Minute)}, ""},
+		{&User{lastTyped: now.Add(-5 * time.Second)}, "typing"},
+		{&User{lastTyped: now.Add(-time.Minute)}, ""},
+		{&User{lastAnswered: now.Add(-30 * time.Second)}, "just answered"},
+		{&User{lastAnswered: now.Add(-2 * time.Minute)}, ""},
+	}
+	for i, test := range tests {
+		if reason, held := test.user.nagHeldBack(now); reason != test.reason || held != (test.reason != "") {
+			t.Errorf("%d: held back %t because %q; want %q", i, held, reason, test.reason)
+		}
+	}
+}
+
+func TestSnoozeCommands(t *testing.T) {
+	b := newTestBot(t, slack.User{Id: "U1", Name: "bob"})
+	defer b.Close()
+
+	b.start(t, testChannel("C1", "design", "U1"), "U1")
+	b.say("U1", "snooze 10m")
+	b.slack.waitForDM(t, "U1", builtinReplies.Render(replySnoozedFor, replyData{Minutes: 10}))
+	b.say("U1", "Snooze")
+	b.slack.waitForDM(t, "U1", UserSnoozedText)
+
+	// answers, not snoozes
+	for i, answer := range []string{"snooze 10", "snoozed through my alarm", "snooze button", "sleepy"} {
+		b.say("U1", answer)
+		if i+1 < len(Questions) {
+			b.slack.waitForDM(t, "U1", Questions[i+1])
+		}
+	}
+	b.slack.waitForDM(t, "U1", UserStandupEndText)
+	b.waitReported(t)
+
+	records, err := b.history.Load()
+	if err != nil || len(records) != 1 {
+		t.Fatalf("got %v, %v; want one stand-up", records, err)
+	}
+	want := []string{"snooze 10", "snoozed through my alarm", "snooze button", "sleepy"}
+	if got := records[0].Participants[0].Answers; !equalStrings(got, want) {
+		t.Errorf("got answers %q; want %q", got, want)
+	}
+}
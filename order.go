@@ -0,0 +1,105 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// How people are ordered in the summary.
+const (
+	// alphabetically by real name, or user name if they haven't one
+	orderName = "name"
+	// first to finish first
+	orderCompleted = "completed"
+	// as the channel, or its roster, lists them
+	orderChannel = "channel"
+	// answered, then skipped, then absent, each by name
+	orderStatus = "status"
+)
+
+type userSorter struct {
+	users []*User
+	less  func(a, b *User) bool
+}
+
+func (self userSorter) Len() int           { return len(self.users) }
+func (self userSorter) Swap(i, j int)      { self.users[i], self.users[j] = self.users[j], self.users[i] }
+func (self userSorter) Less(i, j int) bool { return self.less(self.users[i], self.users[j]) }
+
+func sortName(u *User) string {
+	if u.Info().RealName != "" {
+		return strings.ToLower(u.Info().RealName)
+	}
+	return strings.ToLower(u.Info().Name)
+}
+
+func byName(a, b *User) bool {
+	if an, bn := sortName(a), sortName(b); an != bn {
+		return an < bn
+	}
+	return a.Info().Id < b.Info().Id
+}
+
+/* orderedUsers is everyone with a reply, in the channel's order, leaving out
+ * anyone who's still going unless it's final. Whatever the order, ties go by
+ * name, so the summary's the same every time.
+ */
+// must be called holding userRepliesMutex
+func (self *Standup) orderedUsers(final bool) []*User {
+	users := make([]*User, 0, len(self.userReplies))
+	for user := range self.userReplies {
+		if !final && !self.isDone(user) && !self.closed[user] {
+			continue
+		}
+		users = append(users, user)
+	}
+	sort.Sort(userSorter{users, byName})
+
+	switch self.config.Order {
+	case orderCompleted:
+		sort.Stable(userSorter{users, func(a, b *User) bool {
+			at, aok := self.completedAt[a]
+			bt, bok := self.completedAt[b]
+			if aok && bok {
+				return at.Before(bt)
+			}
+			return aok && !bok
+		}})
+	case orderChannel:
+		positions := make(map[string]int, len(self.userIds))
+		for i, userId := range self.userIds {
+			positions[userId] = i
+		}
+		position := func(u *User) int {
+			if i, ok := positions[u.Info().Id]; ok {
+				return i
+			}
+			// they've left, but what they told us is still in
+			return len(positions)
+		}
+		sort.Stable(userSorter{users, func(a, b *User) bool {
+			return position(a) < position(b)
+		}})
+	case orderStatus:
+		sort.Stable(userSorter{users, func(a, b *User) bool {
+			return statusRank(self.userReplies[a]) < statusRank(self.userReplies[b])
+		}})
+	}
+	return users
+}
+
+func statusRank(reply userReply) int {
+	switch r := reply.(type) {
+	case userAnswersReply:
+		if r.isCompleted() {
+			return 0
+		}
+		return 1
+	case userSkippedReply:
+		return 2
+	case userAbsentReply:
+		return 3
+	default:
+		return 4
+	}
+}
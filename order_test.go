@@ -0,0 +1,102 @@
+package main
+
+import (
+	"github.com/abourget/slack"
+	"testing"
+	"time"
+)
+
+func TestOrderedUsers(t *testing.T) {
+	amy := &User{info: slack.User{Id: "U1", Name: "amy", RealName: "Zoe Amy"}}
+	bob := &User{info: slack.User{Id: "U2", Name: "bob"}}
+	cat := &User{info: slack.User{Id: "U3", Name: "cat", RealName: "Cat Smith"}}
+	dan := &User{info: slack.User{Id: "U4", Name: "dan"}}
+	eve := &User{info: slack.User{Id: "U5", Name: "eve"}}
+	// a namesake, after bob by id
+	bob2 := &User{info: slack.User{Id: "U6", Name: "Bob"}}
+
+	now := time.Now()
+	s := &Standup{
+		// eve's left the channel
+		userIds: []string{"U4", "U3", "U2", "U1", "U6"},
+		userReplies: map[*User]userReply{
+			amy:  userAnswersReply{"a", "b"},
+			bob:  userAbsentReply{},
+			cat:  userAnswersReply{"a", ""},
+			dan:  userSkippedReply{},
+			eve:  userAnswersReply{"a", "b"},
+			bob2: userErrorReply{},
+		},
+		completedAt: map[*User]time.Time{
+			amy: now.Add(-time.Minute),
+			eve: now.Add(-2 * time.Minute),
+		},
+		closed: map[*User]bool{cat: true},
+	}
+
+	tests := []struct {
+		order string
+		final bool
+		want  []*User
+	}{
+		{orderName, true, []*User{bob, bob2, cat, dan, eve, amy}},
+		// bob's still going
+		{orderName, false, []*User{bob2, cat, dan, eve, amy}},
+		// then everyone who didn't finish, by name
+		{orderCompleted, true, []*User{eve, amy, bob, bob2, cat, dan}},
+		{orderChannel, true, []*User{dan, cat, bob, amy, bob2, eve}},
+		{orderStatus, true, []*User{eve, amy, cat, dan, bob, bob2}},
+		// an order we don't know is by name
+		{"", true, []*User{bob, bob2, cat, dan, eve, amy}},
+	}
+	for _, test := range tests {
+		s.config.Order = test.order
+		got := s.orderedUsers(test.final)
+		if userIdsOf(got) != userIdsOf(test.want) {
+			t.Errorf("%q, final %t: got %s; want %s", test.order, test.final, userIdsOf(got), userIdsOf(test.want))
+		}
+	}
+}
+
+func TestProgressOrder(t *testing.T) {
+	amy := &User{info: slack.User{Id: "U1", Name: "amy"}}
+	bob := &User{info: slack.User{Id: "U2", Name: "bob"}}
+	cat := &User{info: slack.User{Id: "U3", Name: "cat"}}
+	s := &Standup{
+		Channel:      slack.Channel{Name: "design"},
+		clockStarted: time.Now(),
+		userIds:      []string{"U3", "U1", "U2"},
+		userReplies: map[*User]userReply{
+			amy: userAnswersReply{"a", ""},
+			bob: userAbsentReply{},
+			cat: userSkippedReply{},
+		},
+	}
+	replies, err := parseReplies(map[string]string{replyAdminStatus: "{{range .People}}{{.User}} {{end}}"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// everyone, however far they've got, in the summary's order
+	tests := map[string]string{
+		orderName:    "<@U1|amy> <@U2|bob> <@U3|cat> ",
+		orderChannel: "<@U3|cat> <@U1|amy> <@U2|bob> ",
+		orderStatus:  "<@U1|amy> <@U3|cat> <@U2|bob> ",
+	}
+	for order, want := range tests {
+		s.config.Order = order
+		// again and again, since maps are in any order
+		for i := 0; i < 10; i++ {
+			if got := s.Progress(replies); got != want {
+				t.Fatalf("%q: got %q; want %q", order, got, want)
+			}
+		}
+	}
+}
+
+func userIdsOf(users []*User) (s string) {
+	for _, u := range users {
+		s += u.Info().Id + " "
+	}
+	return
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultPreferencesFile = "tilly-preferences.json"
+
+const preferencesDateFormat = "2006-01-02"
+
+type UserPreferences struct {
+	// The first day they're back, in preferencesDateFormat
+	PausedUntil string `json:"paused_until,omitempty"`
+	// Channel ids
+	OptedOut []string `json:"opted_out,omitempty"`
+	// Only ask on these days, or every day if empty
+	Weekdays []time.Weekday `json:"weekdays,omitempty"`
+	// Ask in this locale instead of each channel's own
+	Locale string `json:"locale,omitempty"`
+}
+
+func (self UserPreferences) isOptedOut(channelId string) bool {
+	for _, id := range self.OptedOut {
+		if id == channelId {
+			return true
+		}
+	}
+	return false
+}
+
+// OnLeave says whether someone shouldn't be asked to a stand-up in the given
+// channel on the given day.
+func (self UserPreferences) OnLeave(channelId string, day time.Time) bool {
+	if self.PausedUntil != "" && day.Format(preferencesDateFormat) < self.PausedUntil {
+		return true
+	}
+	if self.isOptedOut(channelId) {
+		return true
+	}
+	if len(self.Weekdays) == 0 {
+		return false
+	}
+	for _, wd := range self.Weekdays {
+		if wd == day.Weekday() {
+			return false
+		}
+	}
+	return true
+}
+
+func (self UserPreferences) Describe(replies *Replies) string {
+	var data preferencesData
+	if self.PausedUntil != "" && time.Now().Format(preferencesDateFormat) < self.PausedUntil {
+		data.Paused = true
+		data.Until, _ = time.ParseInLocation(preferencesDateFormat, self.PausedUntil, time.Local)
+	}
+	for _, id := range self.OptedOut {
+		data.OptedOut = append(data.OptedOut, fmt.Sprintf("<#%s>", id))
+	}
+	for _, wd := range self.Weekdays {
+		data.Weekdays = append(data.Weekdays, replies.Day(wd))
+	}
+	if self.Locale != "" {
+		data.Language = self.Locale
+		if cat, ok := Settings.Catalogue(self.Locale); ok {
+			data.Language = cat.Name
+		}
+	}
+	if !data.Paused && len(data.OptedOut) == 0 && len(data.Weekdays) == 0 && data.Language == "" {
+		return replies.Render(replyNoPreferences, nil)
+	}
+	return replies.Render(replyPreferences, data)
+}
+
+/* Preferences are durable, so they live in a JSON file of their own that
+ * we rewrite whenever anyone changes theirs.
+ */
+type Preferences struct {
+	path  string
+	users map[string]UserPreferences
+	mutex sync.Mutex
+}
+
+func LoadPreferences(path string) (prefs *Preferences, err error) {
+	prefs = &Preferences{path: path, users: make(map[string]UserPreferences)}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return prefs, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, &prefs.users); err != nil {
+		return nil, err
+	}
+	return prefs, nil
+}
+
+func (self *Preferences) Get(userId string) UserPreferences {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	return self.users[userId].copy()
+}
+
+// copy is a copy that can be changed without changing this one.
+func (self UserPreferences) copy() UserPreferences {
+	self.OptedOut = append([]string(nil), self.OptedOut...)
+	self.Weekdays = append([]time.Weekday(nil), self.Weekdays...)
+	return self
+}
+
+// Update changes someone's preferences, as long as we can save the change.
+func (self *Preferences) Update(userId string, change func(*UserPreferences)) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	p := self.users[userId].copy()
+	change(&p)
+	users := make(map[string]UserPreferences, len(self.users)+1)
+	for id, other := range self.users {
+		users[id] = other
+	}
+	users[userId] = p
+
+	data, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := self.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, self.path); err != nil {
+		return err
+	}
+	self.users = users
+	return nil
+}
+
+var weekdaysByName = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday, "sundays": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday, "mondays": time.Monday,
+	"tue": time.Tuesday, "tues": time.Tuesday, "tuesday": time.Tuesday, "tuesdays": time.Tuesday,
+	"wed": time.Wednesday, "weds": time.Wednesday, "wednesday": time.Wednesday, "wednesdays": time.Wednesday,
+	"thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday, "thursday": time.Thursday, "thursdays": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday, "fridays": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday, "saturdays": time.Saturday,
+}
+
+// parseWeekdays reads lists like "Mon/Wed", "mon, wed and fri".
+func parseWeekdays(words []string) (days []time.Weekday, ok bool) {
+	seen := make(map[time.Weekday]bool)
+	for _, w := range words {
+		for _, name := range strings.FieldsFunc(strings.ToLower(w), func(r rune) bool {
+			return r == '/' || r == ',' || r == '&' || r == '+'
+		}) {
+			if name == "and" {
+				continue
+			}
+			wd, known := weekdaysByName[name]
+			if !known {
+				return nil, false
+			}
+			if !seen[wd] {
+				seen[wd] = true
+				days = append(days, wd)
+			}
+		}
+	}
+	return days, len(days) > 0
+}
+
+/* Preference commands are a sentence each:
+ *
+ *   pause until 2026-11-02
+ *   resume
+ *   opt out of #design
+ *   opt in to #design
+ *   only ask me on Mon/Wed
+ *   ask me every day
+ *   language pt
+ *   language default
+ *   preferences
+ */
+func (self *User) handlePreferenceCommand(text string) bool {
+	if self.manager.preferences == nil {
+		return false
+	}
+	words := strings.Fields(text)
+	lower := strings.Fields(normaliseCommand(text))
+	has := func(prefix ...string) bool {
+		if len(lower) < len(prefix) {
+			return false
+		}
+		for i, p := range prefix {
+			if lower[i] != p {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch {
+	case has("preferences") && len(lower) == 1:
+		self.tell(self.manager.preferences.Get(self.Info().Id).Describe(self.replies()))
+
+	case has("pause", "until") && len(lower) == 3:
+		until, err := time.ParseInLocation(preferencesDateFormat, lower[2], time.Local)
+		if err != nil {
+			self.tell(self.replyText(replyBadDate, nil))
+			return true
+		}
+		self.updatePreferences(func(p *UserPreferences) {
+			p.PausedUntil = until.Format(preferencesDateFormat)
+		}, replyPaused, replyData{Until: until})
+
+	case (has("resume") || has("unpause")) && len(lower) == 1:
+		self.updatePreferences(func(p *UserPreferences) {
+			p.PausedUntil = ""
+		}, replyResumed, nil)
+
+	case (has("opt", "out", "of") || has("opt", "in", "to")) && len(words) == 4 && looksLikeChannel(words[3]):
+		optOut := lower[1] == "out"
+		go self.setOptOut(words[3], optOut)
+
+	case has("opt", "into") && len(words) == 3 && looksLikeChannel(words[2]):
+		go self.setOptOut(words[2], false)
+
+	case has("only", "ask", "me", "on") && len(lower) > 4:
+		days, ok := parseWeekdays(lower[4:])
+		if !ok {
+			return false
+		}
+		self.updatePreferences(func(p *UserPreferences) {
+			p.Weekdays = days
+		}, replyWeekdays, nil)
+
+	case has("ask", "me", "every", "day") && len(lower) == 4:
+		self.updatePreferences(func(p *UserPreferences) {
+			p.Weekdays = nil
+		}, replyEveryDay, nil)
+
+	case has("language", "default") && len(lower) == 2:
+		self.updatePreferences(func(p *UserPreferences) {
+			p.Locale = ""
+		}, replyDefaultLanguage, nil)
+
+	case has("language") && len(lower) == 2:
+		locale, ok := Settings.FindLocale(words[1])
+		if !ok {
+			self.tell(self.replyText(replyUnknownLanguage, replyData{Language: words[1], Languages: Settings.DescribeLocales()}))
+			return true
+		}
+		cat, _ := Settings.Catalogue(locale)
+		self.updatePreferences(func(p *UserPreferences) {
+			p.Locale = locale
+		}, replyLanguage, replyData{Language: cat.Name})
+
+	default:
+		return false
+	}
+	return true
+}
+
+func (self *User) setOptOut(channelRef string, optOut bool) {
+	ch, err := self.manager.standups.FindChannel(channelRef)
+	if err != nil || ch == nil {
+		self.tell(self.replyText(replyAdminUnknownChannel, replyData{Channel: channelRef}))
+		return
+	}
+
+	if optOut {
+		self.updatePreferences(func(p *UserPreferences) {
+			if !p.isOptedOut(ch.Id) {
+				p.OptedOut = append(p.OptedOut, ch.Id)
+			}
+		}, replyOptedOut, replyData{Channel: ch.Name})
+		return
+	}
+
+	self.updatePreferences(func(p *UserPreferences) {
+		p.OptedOut = removeUserId(p.OptedOut, ch.Id)
+	}, replyOptedIn, replyData{Channel: ch.Name})
+}
+
+// updatePreferences confirms the change once it's saved, so in whatever
+// language they've chosen now.
+func (self *User) updatePreferences(change func(*UserPreferences), reply string, data interface{}) {
+	if err := self.manager.preferences.Update(self.Info().Id, change); err != nil {
+		self.logger.Errorf("error saving preferences: %s", err)
+		self.tell(self.replyText(replyPreferencesError, nil))
+		return
+	}
+	self.tell(self.replyText(reply, data))
+}
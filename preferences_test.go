@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/abourget/slack"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPreferencesOnLeave(t *testing.T) {
+	monday := time.Date(2026, 10, 19, 9, 30, 0, 0, time.Local)
+	tuesday := monday.AddDate(0, 0, 1)
+
+	tests := []struct {
+		prefs   UserPreferences
+		channel string
+		day     time.Time
+		onLeave bool
+	}{
+		{UserPreferences{}, "C1", monday, false},
+		{UserPreferences{PausedUntil: "2026-10-20"}, "C1", monday, true},
+		// it's the day they're back
+		{UserPreferences{PausedUntil: "2026-10-20"}, "C1", tuesday, false},
+		{UserPreferences{OptedOut: []string{"C2"}}, "C1", monday, false},
+		{UserPreferences{OptedOut: []string{"C2"}}, "C2", monday, true},
+		{UserPreferences{Weekdays: []time.Weekday{time.Monday, time.Wednesday}}, "C1", monday, false},
+		{UserPreferences{Weekdays: []time.Weekday{time.Monday, time.Wednesday}}, "C1", tuesday, true},
+	}
+	for _, test := range tests {
+		if onLeave := test.prefs.OnLeave(test.channel, test.day); onLeave != test.onLeave {
+			t.Errorf("%+v.OnLeave(%s, %s) = %t", test.prefs, test.channel, test.day.Weekday(), onLeave)
+		}
+	}
+}
+
+func TestParseWeekdays(t *testing.T) {
+	tests := []struct {
+		words []string
+		days  []time.Weekday
+		ok    bool
+	}{
+		{[]string{"mon/wed"}, []time.Weekday{time.Monday, time.Wednesday}, true},
+		{[]string{"Mondays,", "Weds", "and", "fri"}, []time.Weekday{time.Monday, time.Wednesday, time.Friday}, true},
+		{[]string{"tue+tue&thurs"}, []time.Weekday{time.Tuesday, time.Thursday}, true},
+		{[]string{"mon", "and", "someday"}, nil, false},
+		{[]string{"and"}, nil, false},
+	}
+	for _, test := range tests {
+		days, ok := parseWeekdays(test.words)
+		if ok != test.ok || fmt.Sprint(days) != fmt.Sprint(test.days) {
+			t.Errorf("parseWeekdays(%q) = %v, %t; want %v, %t", test.words, days, ok, test.days, test.ok)
+		}
+	}
+}
+
+func TestPreferencesPersist(t *testing.T) {
+	dir, cleanUp := tempDir(t)
+	defer cleanUp()
+	path := filepath.Join(dir, "preferences.json")
+
+	prefs, err := LoadPreferences(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = prefs.Update("U1", func(p *UserPreferences) { p.OptedOut = []string{"C1"} }); err != nil {
+		t.Fatal(err)
+	}
+
+	if prefs, err = LoadPreferences(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := prefs.Get("U1"); !got.isOptedOut("C1") {
+		t.Errorf("got %+v after loading again; want opted out of C1", got)
+	}
+}
+
+func TestPreferencesUpdateFails(t *testing.T) {
+	dir, cleanUp := tempDir(t)
+	defer cleanUp()
+	path := filepath.Join(dir, "preferences.json")
+
+	prefs, err := LoadPreferences(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = prefs.Update("U1", func(p *UserPreferences) { p.OptedOut = []string{"C1", "C2"} }); err != nil {
+		t.Fatal(err)
+	}
+	// something's in the way, so we can't save
+	if err = os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.MkdirAll(filepath.Join(path, "in-the-way"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = prefs.Update("U1", func(p *UserPreferences) { p.OptedOut = removeUserId(p.OptedOut, "C1") }); err == nil {
+		t.Fatal("saved over a directory")
+	}
+	if err = prefs.Update("U2", func(p *UserPreferences) { p.PausedUntil = "2026-11-02" }); err == nil {
+		t.Fatal("saved over a directory")
+	}
+	if got := prefs.Get("U1"); fmt.Sprint(got.OptedOut) != "[C1 C2]" {
+		t.Errorf("got %+v; want the change we couldn't save undone", got)
+	}
+	if got := prefs.Get("U2"); got.PausedUntil != "" {
+		t.Errorf("got %+v; want nothing we couldn't save", got)
+	}
+}
+
+func TestPreferencesGetCopies(t *testing.T) {
+	dir, cleanUp := tempDir(t)
+	defer cleanUp()
+
+	prefs, err := LoadPreferences(filepath.Join(dir, "preferences.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefs.Update("U1", func(p *UserPreferences) {
+		p.OptedOut = []string{"C1", "C2", "C3"}
+		p.Weekdays = []time.Weekday{time.Monday}
+	})
+
+	got := prefs.Get("U1")
+	got.Weekdays[0] = time.Sunday
+	prefs.Update("U1", func(p *UserPreferences) { p.OptedOut = removeUserId(p.OptedOut, "C1") })
+	if fmt.Sprint(got.OptedOut) != "[C1 C2 C3]" {
+		t.Errorf("got %q from before opting in; want it unchanged", got.OptedOut)
+	}
+	if again := prefs.Get("U1"); fmt.Sprint(again.OptedOut) != "[C2 C3]" || again.Weekdays[0] != time.Monday {
+		t.Errorf("got %+v; want only what we updated changed", again)
+	}
+}
+
+func TestOnLeaveTheDayTheyreAsked(t *testing.T) {
+	defer func(settings *Config) { Settings = settings }(Settings)
+	Settings = &Config{Channels: map[string]json.RawMessage{
+		"design": json.RawMessage(`{"start_mode": "local", "local_start_time": "07:00"}`),
+	}}
+	dir, cleanUp := tempDir(t)
+	defer cleanUp()
+	prefs, err := LoadPreferences(filepath.Join(dir, "preferences.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Monday's has gone, so they'll be asked on Tuesday
+	now := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	prefs.Update("U1", func(p *UserPreferences) { p.Weekdays = []time.Weekday{time.Tuesday} })
+	prefs.Update("U2", func(p *UserPreferences) { p.Weekdays = []time.Weekday{time.Monday} })
+	prefs.Update("U3", func(p *UserPreferences) { p.PausedUntil = "2026-10-20" })
+	directory := NewUserDirectory(newFakeUserSource(
+		slack.User{Id: "U1", Name: "amy", TZ: "UTC"},
+		slack.User{Id: "U2", Name: "bob", TZ: "UTC"},
+		slack.User{Id: "U3", Name: "cat", TZ: "UTC"},
+	))
+	client := &AuthedSlack{UserId: "UTILLY"}
+
+	plan, err := planChannel(client, directory, prefs, nil, testChannel("C1", "design", "U1", "U2", "U3"), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(plan.standup.userIds) != "[U1 U3]" || fmt.Sprint(plan.standup.onLeave) != "[U2]" {
+		t.Errorf("asking %q, with %q on leave; want amy and cat, on Tuesday", plan.standup.userIds, plan.standup.onLeave)
+	}
+}
+
+func TestPreferenceCommands(t *testing.T) {
+	b := newTestBot(t, slack.User{Id: "U1", Name: "bob"})
+	defer b.Close()
+
+	tests := []struct {
+		command string
+		reply   string
+	}{
+		{"pause until 2026-11-02", "Okay, I won't ask you to any stand-ups until Monday 2 November. Enjoy!"},
+		{"pause until tomorrow", UserBadDateText},
+		{"Only ask me on Mon/Wed", UserWeekdaysText},
+		{"resume", UserResumedText},
+		// and from now on, in German
+		{"language Deutsch", "Okay, ich frage dich ab jetzt auf Deutsch."},
+		{"language klingon", "Ich spreche kein klingon. Ich kann " + Settings.DescribeLocales() + "."},
+		{"preferences", "Ich frage dich nur am Montag, Mittwoch.\nIch frage dich auf Deutsch.\n"},
+	}
+	for _, test := range tests {
+		b.say("U1", test.command)
+		b.slack.waitForDM(t, "U1", test.reply)
+	}
+
+	got := b.users.preferences.Get("U1")
+	if got.PausedUntil != "" || fmt.Sprint(got.Weekdays) != "[Monday Wednesday]" || got.Locale != "de" {
+		t.Errorf("got %+v; want to be asked in German on Mondays and Wednesdays", got)
+	}
+}
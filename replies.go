@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+	"time"
+)
+
+/* Replies are what we say back when someone tells us something that isn't an
+ * answer: commands, preferences, snoozing and admin in DMs, and mentions in
+ * channels. They're text/templates, like the rest of what we say, and a
+ * locale's catalogue can translate them in its "replies", by these names.
+ * DMs are replied to in the language someone's chosen, or otherwise the
+ * defaults' locale, and mentions in the channel's.
+ *
+ * Replies about a channel get its name as .Channel, or whatever was said for
+ * it if we couldn't find it. Extending gets the new deadline as .Ends,
+ * pausing the day they're back as .Until, snoozing .Minutes, and languages
+ * .Language, with the ones we speak as .Languages if we don't speak it.
+ * Mentions get .User, a link to whoever mentioned us, and who's missing
+ * gets links to them as .Users.
+ *
+ * Status gets .Channel, .Started, .Ends and .People, each with .User and
+ * either .Absent, .Skipped, .Error or how many .Answered of the .Questions.
+ * Preferences get .Paused and .Until, .OptedOut, links to channels,
+ * .Weekdays, names of days, and .Language, and stats get the counts of
+ * stand-ups .Asked, .Answered, .Partial, .Skipped and .Missed, the .Rate they
+ * answer at as a percentage, their .Average time to finish, if they've ever
+ * finished, and their .Streak and .LongestStreak.
+ */
+const (
+	replyAdminStarted        = "admin_started"
+	replyAdminEnded          = "admin_ended"
+	replyAdminCancelled      = "admin_cancelled"
+	replyAdminExtended       = "admin_extended"
+	replyAdminAlreadyRunning = "admin_already_running"
+	replyAdminNotRunning     = "admin_not_running"
+	replyAdminNothingRunning = "admin_nothing_running"
+	replyAdminShuttingDown   = "admin_shutting_down"
+	replyAdminNotMember      = "admin_not_member"
+	replyAdminUnknownChannel = "admin_unknown_channel"
+	replyAdminChannelError   = "admin_channel_error"
+	replyAdminStatus         = "admin_status"
+
+	replyMentionStarted        = "mention_started"
+	replyMentionAlreadyRunning = "mention_already_running"
+	replyMentionShuttingDown   = "mention_shutting_down"
+	replyMentionNotRunning     = "mention_not_running"
+	replyMentionSkipped        = "mention_skipped"
+	replyMentionNotAsked       = "mention_not_asked"
+	replyMentionMissing        = "mention_missing"
+	replyMentionNobodyMissing  = "mention_nobody_missing"
+	replyMentionError          = "mention_error"
+	replyMentionHelp           = "mention_help"
+
+	replyNoPreferences    = "no_preferences"
+	replyPreferences      = "preferences"
+	replyPreferencesError = "preferences_error"
+	replyBadDate          = "bad_date"
+	replyPaused           = "paused"
+	replyResumed          = "resumed"
+	replyOptedOut         = "opted_out"
+	replyOptedIn          = "opted_in"
+	replyWeekdays         = "weekdays"
+	replyEveryDay         = "every_day"
+	replyLanguage         = "language"
+	replyDefaultLanguage  = "default_language"
+	replyUnknownLanguage  = "unknown_language"
+	replyNoStats          = "no_stats"
+	replyStats            = "stats"
+	replySnoozed          = "snoozed"
+	replySnoozedFor       = "snoozed_for"
+)
+
+var defaultReplies = map[string]string{
+	replyAdminStarted:        AdminStartedText,
+	replyAdminEnded:          AdminEndedText,
+	replyAdminCancelled:      AdminCancelledText,
+	replyAdminExtended:       AdminExtendedText,
+	replyAdminAlreadyRunning: AdminAlreadyRunningText,
+	replyAdminNotRunning:     AdminNotRunningText,
+	replyAdminNothingRunning: AdminNothingRunningText,
+	replyAdminShuttingDown:   AdminShuttingDownText,
+	replyAdminNotMember:      AdminNotMemberText,
+	replyAdminUnknownChannel: AdminUnknownChannelText,
+	replyAdminChannelError:   AdminChannelErrorText,
+	replyAdminStatus:         AdminStatusText,
+
+	replyMentionStarted:        MentionStartedText,
+	replyMentionAlreadyRunning: MentionAlreadyRunningText,
+	replyMentionShuttingDown:   MentionShuttingDownText,
+	replyMentionNotRunning:     MentionNotRunningText,
+	replyMentionSkipped:        MentionSkippedText,
+	replyMentionNotAsked:       MentionNotAskedText,
+	replyMentionMissing:        MentionMissingText,
+	replyMentionNobodyMissing:  MentionNobodyMissingText,
+	replyMentionError:          MentionErrorText,
+	replyMentionHelp:           MentionHelpText,
+
+	replyNoPreferences:    UserNoPreferencesText,
+	replyPreferences:      UserPreferencesText,
+	replyPreferencesError: UserPreferencesErrorText,
+	replyBadDate:          UserBadDateText,
+	replyPaused:           UserPausedText,
+	replyResumed:          UserResumedText,
+	replyOptedOut:         UserOptedOutText,
+	replyOptedIn:          UserOptedInText,
+	replyWeekdays:         UserWeekdaysText,
+	replyEveryDay:         UserEveryDayText,
+	replyLanguage:         UserLanguageText,
+	replyDefaultLanguage:  UserDefaultLanguageText,
+	replyUnknownLanguage:  UserUnknownLanguageText,
+	replyNoStats:          UserNoStatsText,
+	replyStats:            UserStatsText,
+	replySnoozed:          UserSnoozedText,
+	replySnoozedFor:       UserSnoozedForText,
+}
+
+type replyData struct {
+	Channel   string
+	User      string
+	Users     []string
+	Ends      time.Time
+	Until     time.Time
+	Minutes   int
+	Language  string
+	Languages string
+}
+
+type statusData struct {
+	Channel string
+	Started time.Time
+	Ends    time.Time
+	People  []statusPersonData
+}
+
+type statusPersonData struct {
+	User      string
+	Absent    bool
+	Skipped   bool
+	Error     bool
+	Answered  int
+	Questions int
+}
+
+type preferencesData struct {
+	Paused   bool
+	Until    time.Time
+	OptedOut []string
+	Weekdays []string
+	Language string
+}
+
+type statsData struct {
+	Asked         int
+	Answered      int
+	Partial       int
+	Skipped       int
+	Missed        int
+	Rate          int
+	Average       string
+	Streak        int
+	LongestStreak int
+}
+
+// Replies are our replies in one language, ready to render, and what the
+// days of the week are called in it.
+type Replies struct {
+	templates *template.Template
+	days      []string
+}
+
+var builtinReplies, _ = parseReplies(nil, nil)
+
+// parseReplies parses our replies, with any overrides, and the names of the
+// days, Sunday first, or ours if there aren't any.
+func parseReplies(overrides map[string]string, days []string) (*Replies, error) {
+	r := &Replies{templates: template.New("").Funcs(templateFuncs), days: days}
+	for name, text := range defaultReplies {
+		if override, ok := overrides[name]; ok {
+			text = override
+		}
+		if _, err := r.templates.New(name).Parse(text); err != nil {
+			return nil, fmt.Errorf("reply %s: %s", name, err)
+		}
+	}
+	for name := range overrides {
+		if _, ok := defaultReplies[name]; !ok {
+			return nil, fmt.Errorf("there's no reply called %s", name)
+		}
+	}
+	if len(days) == 0 {
+		for wd := time.Sunday; wd <= time.Saturday; wd++ {
+			r.days = append(r.days, wd.String())
+		}
+	} else if len(days) != 7 {
+		return nil, fmt.Errorf("there are %d days, not 7", len(days))
+	}
+	return r, nil
+}
+
+// Render renders a reply, falling back on ours if the locale's fails.
+func (self *Replies) Render(name string, data interface{}) string {
+	var out bytes.Buffer
+	if err := self.templates.ExecuteTemplate(&out, name, data); err != nil {
+		Log.Errorf("error rendering reply %s: %s", name, err)
+		if self != builtinReplies {
+			return builtinReplies.Render(name, data)
+		}
+	}
+	return out.String()
+}
+
+func (self *Replies) Day(wd time.Weekday) string {
+	return self.days[wd]
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/abourget/slack"
+	"net/http"
+	"net/url"
+)
+
+/* The Slack library doesn't cover everything we need, or not quite how we
+ * need it, so these call the Web API directly.
+ */
+
+func (self *AuthedSlack) callAPI(method string, values url.Values, out interface{}) error {
+	return self.countError(method, self.doCallAPI(method, values, out))
+}
+
+func (self *AuthedSlack) doCallAPI(method string, values url.Values, out interface{}) error {
+	values.Set("token", self.Token)
+	resp, err := http.PostForm(slack.SLACK_API+method, values)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var status slack.SlackResponse
+	var body json.RawMessage
+	if err = json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return err
+	}
+	if err = json.Unmarshal(body, &status); err != nil {
+		return err
+	}
+	if !status.Ok {
+		return errors.New(status.Error)
+	}
+	if out != nil {
+		return json.Unmarshal(body, out)
+	}
+	return nil
+}
+
+// UpdateMessageText replaces the text, and any attachments, of a message
+// we've posted. Unlike the library's UpdateMessage, it doesn't escape the
+// links we've formatted.
+func (self *AuthedSlack) UpdateMessageText(channelId, timestamp, text string, attachments []slack.Attachment) error {
+	values := url.Values{
+		"channel": {channelId},
+		"ts":      {timestamp},
+		"text":    {text},
+		"parse":   {"none"},
+		"as_user": {"true"},
+	}
+	if attachments != nil {
+		data, err := json.Marshal(attachments)
+		if err != nil {
+			return err
+		}
+		values.Set("attachments", string(data))
+	}
+	return self.callAPI("chat.update", values, nil)
+}
+
+type userGroup struct {
+	Id     string   `json:"id"`
+	Handle string   `json:"handle"`
+	Users  []string `json:"users"`
+}
+
+func (self *AuthedSlack) GetUserGroups() ([]userGroup, error) {
+	var out struct {
+		UserGroups []userGroup `json:"usergroups"`
+	}
+	err := self.callAPI("usergroups.list", url.Values{"include_users": {"true"}}, &out)
+	return out.UserGroups, err
+}
+
+/* Everything we call through the library comes through here too, so we can
+ * count what fails.
+ */
+func (self *AuthedSlack) countError(method string, err error) error {
+	if err != nil {
+		metricSlackErrors.Inc(method)
+	}
+	return err
+}
+
+func (self *AuthedSlack) PostMessage(channelId, text string, params slack.PostMessageParameters) (string, string, error) {
+	channel, timestamp, err := self.Client.PostMessage(channelId, text, params)
+	if err == nil && isIMChannelId(channelId) {
+		metricDMsSent.Inc("")
+	}
+	return channel, timestamp, self.countError("chat.postMessage", err)
+}
+
+func (self *AuthedSlack) DeleteMessage(channelId, timestamp string) (string, string, error) {
+	channel, timestamp, err := self.Client.DeleteMessage(channelId, timestamp)
+	return channel, timestamp, self.countError("chat.delete", err)
+}
+
+func (self *AuthedSlack) GetChannelInfo(channelId string) (*slack.Channel, error) {
+	ch, err := self.Client.GetChannelInfo(channelId)
+	return ch, self.countError("channels.info", err)
+}
+
+func (self *AuthedSlack) GetChannels(excludeArchived bool) ([]slack.Channel, error) {
+	chs, err := self.Client.GetChannels(excludeArchived)
+	return chs, self.countError("channels.list", err)
+}
+
+func (self *AuthedSlack) OpenIMChannel(userId string) (bool, bool, string, error) {
+	noOp, alreadyOpen, channelId, err := self.Client.OpenIMChannel(userId)
+	return noOp, alreadyOpen, channelId, self.countError("im.open", err)
+}
+
+func (self *AuthedSlack) GetIMHistory(channelId string, params slack.HistoryParameters) (*slack.History, error) {
+	history, err := self.Client.GetIMHistory(channelId, params)
+	return history, self.countError("im.history", err)
+}
+
+func (self *AuthedSlack) GetIMChannels() ([]slack.IM, error) {
+	ims, err := self.Client.GetIMChannels()
+	return ims, self.countError("im.list", err)
+}
+
+func (self *AuthedSlack) GetUserInfo(userId string) (*slack.User, error) {
+	user, err := self.Client.GetUserInfo(userId)
+	return user, self.countError("users.info", err)
+}
+
+func (self *AuthedSlack) GetUsers() ([]slack.User, error) {
+	users, err := self.Client.GetUsers()
+	return users, self.countError("users.list", err)
+}
+
+func (self *AuthedSlack) GetUserPresence(userId string) (*slack.UserPresence, error) {
+	presence, err := self.Client.GetUserPresence(userId)
+	return presence, self.countError("users.getPresence", err)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"github.com/abourget/slack"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* The Slack library makes its calls through http.DefaultClient and never
+ * looks at the status code, so that's where we retry what's worth retrying
+ * and keep inside Slack's rate limits.
+ *
+ * Anything Slack turned away, because we were rate limited or never got
+ * through at all, is always safe to try again. Server errors are only retried
+ * for calls it's safe to repeat, which is everything we make except posting
+ * messages: better someone misses a question than gets it twice. Users retry
+ * questions themselves, once they've checked the last try didn't get through.
+ *
+ * Retries sleep in the caller's goroutine, which is often a User's, and
+ * they can't do anything else meanwhile. So we give up on a call once
+ * retrying would take it past maxWait.
+ */
+type slackTransport struct {
+	next        http.RoundTripper
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	maxWait     time.Duration
+	// Slack allows about a message a second in each channel.
+	postInterval time.Duration
+
+	mutex       sync.Mutex
+	nextPost    map[string]time.Time
+	methodsHeld map[string]time.Time
+}
+
+var slackUnrepeatableMethods = map[string]bool{
+	"chat.postMessage": true,
+}
+
+var slackPostingMethods = map[string]bool{
+	"chat.postMessage": true,
+	"chat.update":      true,
+}
+
+func newSlackTransport(next http.RoundTripper) *slackTransport {
+	return &slackTransport{
+		next:         next,
+		maxAttempts:  5,
+		baseDelay:    500 * time.Millisecond,
+		maxDelay:     30 * time.Second,
+		maxWait:      time.Minute,
+		postInterval: time.Second,
+		nextPost:     make(map[string]time.Time),
+		methodsHeld:  make(map[string]time.Time),
+	}
+}
+
+func (self *slackTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.HasPrefix(req.URL.String(), slack.SLACK_API) || req.Body == nil {
+		return self.next.RoundTrip(req)
+	}
+
+	method := path.Base(req.URL.Path)
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	channelId := ""
+	if slackPostingMethods[method] {
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			channelId = values.Get("channel")
+		}
+	}
+
+	giveUpAt := time.Now().Add(self.maxWait)
+	for attempt := 1; ; attempt++ {
+		if channelId != "" {
+			self.waitForChannel(channelId)
+		}
+		self.waitForMethod(method)
+
+		try := new(http.Request)
+		*try = *req
+		try.Body = ioutil.NopCloser(bytes.NewReader(body))
+		try.ContentLength = int64(len(body))
+
+		resp, err := self.next.RoundTrip(try)
+		wait, retry := self.shouldRetry(method, attempt, resp, err)
+		if !retry || attempt >= self.maxAttempts || time.Now().Add(wait).After(giveUpAt) {
+			return resp, err
+		}
+
+		if err != nil {
+			Log.With("method", method).Warnf("Slack call failed, retrying in %s: %s", wait, err)
+		} else {
+			Log.With("method", method).Warnf("Slack call got %s, retrying in %s", resp.Status, wait)
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		metricSlackRetries.Inc(method)
+		time.Sleep(wait)
+	}
+}
+
+func (self *slackTransport) shouldRetry(method string, attempt int, resp *http.Response, err error) (wait time.Duration, retry bool) {
+	switch {
+	case err != nil:
+		return self.backoff(attempt), !slackUnrepeatableMethods[method] || neverSent(err)
+
+	case resp.StatusCode == http.StatusTooManyRequests:
+		wait = self.backoff(attempt)
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			wait = time.Duration(seconds) * time.Second
+		}
+		// everyone else calling this has to wait too
+		self.holdMethod(method, time.Now().Add(wait))
+		return wait, true
+
+	case resp.StatusCode >= 500:
+		return self.backoff(attempt), !slackUnrepeatableMethods[method]
+	}
+	return 0, false
+}
+
+// neverSent says whether a request failed before Slack could have seen it.
+func neverSent(err error) bool {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	opErr, ok := err.(*net.OpError)
+	return ok && opErr.Op == "dial"
+}
+
+// backoff doubles each attempt, with jitter so everyone waiting doesn't come
+// back at once.
+func (self *slackTransport) backoff(attempt int) time.Duration {
+	d := self.baseDelay << uint(attempt-1)
+	if d > self.maxDelay || d <= 0 {
+		d = self.maxDelay
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// waitForChannel queues us up behind anything else being posted to the
+// same channel.
+func (self *slackTransport) waitForChannel(channelId string) {
+	self.mutex.Lock()
+	now := time.Now()
+	slot := self.nextPost[channelId]
+	if slot.Before(now) {
+		slot = now
+	}
+	self.nextPost[channelId] = slot.Add(self.postInterval)
+	self.mutex.Unlock()
+
+	time.Sleep(slot.Sub(now))
+}
+
+func (self *slackTransport) holdMethod(method string, until time.Time) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if until.After(self.methodsHeld[method]) {
+		self.methodsHeld[method] = until
+	}
+}
+
+func (self *slackTransport) waitForMethod(method string) {
+	self.mutex.Lock()
+	until := self.methodsHeld[method]
+	self.mutex.Unlock()
+
+	if wait := until.Sub(time.Now()); wait > 0 {
+		time.Sleep(wait)
+	}
+}
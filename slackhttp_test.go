@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"github.com/abourget/slack"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// roundTrips answers each request with the next status, or fails it with
+// the next error, and keeps what it was sent.
+type roundTrips struct {
+	mutex    sync.Mutex
+	statuses []int
+	errs     []error
+	bodies   []string
+	headers  http.Header
+}
+
+func (self *roundTrips) RoundTrip(req *http.Request) (*http.Response, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	body, _ := ioutil.ReadAll(req.Body)
+	self.bodies = append(self.bodies, string(body))
+	n := len(self.bodies) - 1
+	if n < len(self.errs) && self.errs[n] != nil {
+		return nil, self.errs[n]
+	}
+	status := http.StatusOK
+	if n < len(self.statuses) {
+		status = self.statuses[n]
+	}
+	header := http.Header{}
+	for k, v := range self.headers {
+		header[k] = v
+	}
+	return &http.Response{StatusCode: status, Status: http.StatusText(status), Header: header,
+		Body: ioutil.NopCloser(strings.NewReader(`{"ok": true}`))}, nil
+}
+
+func (self *roundTrips) Calls() int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return len(self.bodies)
+}
+
+func testTransport(next *roundTrips) *slackTransport {
+	t := newSlackTransport(next)
+	t.baseDelay, t.maxDelay, t.postInterval = time.Millisecond, 4*time.Millisecond, 0
+	return t
+}
+
+func slackRequest(t *testing.T, method string, values url.Values) *http.Request {
+	req, err := http.NewRequest("POST", slack.SLACK_API+method, strings.NewReader(values.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestSlackTransportRetries(t *testing.T) {
+	refused := &url.Error{Op: "Post", URL: slack.SLACK_API, Err: &net.OpError{Op: "dial", Err: errors.New("refused")}}
+	reset := &url.Error{Op: "Post", URL: slack.SLACK_API, Err: &net.OpError{Op: "read", Err: errors.New("reset")}}
+
+	tests := []struct {
+		method   string
+		statuses []int
+		errs     []error
+		calls    int
+		status   int
+	}{
+		{"users.info", nil, nil, 1, http.StatusOK},
+		{"users.info", []int{500, 502, 200}, nil, 3, http.StatusOK},
+		{"users.info", []int{500, 500, 500, 500, 500, 500}, nil, 5, 500},
+		{"users.info", []int{404}, nil, 1, 404},
+		{"users.info", nil, []error{reset}, 2, http.StatusOK},
+		// Slack may have posted it
+		{"chat.postMessage", []int{500}, nil, 1, 500},
+		{"chat.postMessage", nil, []error{reset}, 1, 0},
+		// but it can't have
+		{"chat.postMessage", []int{429, 200}, nil, 2, http.StatusOK},
+		{"chat.postMessage", nil, []error{refused}, 2, http.StatusOK},
+	}
+	for _, test := range tests {
+		next := &roundTrips{statuses: test.statuses, errs: test.errs}
+		resp, err := testTransport(next).RoundTrip(slackRequest(t, test.method, url.Values{"channel": {"D1"}}))
+
+		status := 0
+		if err == nil {
+			status = resp.StatusCode
+		}
+		if next.Calls() != test.calls || status != test.status {
+			t.Errorf("%s with %v, %v: got %d calls and %d; want %d and %d",
+				test.method, test.statuses, test.errs, next.Calls(), status, test.calls, test.status)
+		}
+		for i, body := range next.bodies {
+			if !strings.Contains(body, "channel=D1") {
+				t.Errorf("%s: attempt %d was sent %q", test.method, i+1, body)
+			}
+		}
+	}
+}
+
+func TestSlackTransportRateLimited(t *testing.T) {
+	next := &roundTrips{statuses: []int{429}, headers: http.Header{"Retry-After": {"1"}}}
+	transport := testTransport(next)
+
+	start := time.Now()
+	if _, err := transport.RoundTrip(slackRequest(t, "users.list", url.Values{})); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited < time.Second {
+		t.Errorf("retried after %s; want to wait as long as Slack asked", waited)
+	}
+	if next.Calls() != 2 {
+		t.Errorf("got %d calls; want 2", next.Calls())
+	}
+}
+
+func TestSlackTransportGivesUp(t *testing.T) {
+	next := &roundTrips{statuses: []int{429, 429}, headers: http.Header{"Retry-After": {"30"}}}
+	transport := testTransport(next)
+	transport.maxWait = 10 * time.Millisecond
+
+	resp, err := transport.RoundTrip(slackRequest(t, "users.list", url.Values{}))
+	if err != nil || resp.StatusCode != 429 || next.Calls() != 1 {
+		t.Errorf("got %v, %v after %d calls; want to give up on a long wait", resp, err, next.Calls())
+	}
+}
+
+func TestSlackTransportPacesPosts(t *testing.T) {
+	next := &roundTrips{}
+	transport := testTransport(next)
+	transport.postInterval = 50 * time.Millisecond
+
+	start := time.Now()
+	for _, channelId := range []string{"C1", "C1", "C2", "C1"} {
+		if _, err := transport.RoundTrip(slackRequest(t, "chat.postMessage", url.Values{"channel": {channelId}})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the third to C1 waits behind the other two; C2 goes straight away
+	if took := time.Since(start); took < 100*time.Millisecond || took > 200*time.Millisecond {
+		t.Errorf("took %s; want about 100ms", took)
+	}
+}
+
+func TestSlackTransportBackoff(t *testing.T) {
+	transport := testTransport(&roundTrips{})
+	transport.baseDelay, transport.maxDelay = 100*time.Millisecond, time.Second
+
+	for attempt, max := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		max *= time.Millisecond
+		if d := transport.backoff(attempt + 1); d < max/2 || d > max {
+			t.Errorf("attempt %d backed off %s; want between %s and %s", attempt+1, d, max/2, max)
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bytes"
 	"fmt"
 	"github.com/abourget/slack"
 	"sync"
@@ -9,19 +8,58 @@ import (
 )
 
 type Standup struct {
-	Questions         []string
-	Finished          bool
-	Channel           slack.Channel
-	Duration          time.Duration
-	client            *AuthedSlack
-	userIds           []string
-	userManager       *UserManager
-	userReplies       map[*User]userReply
+	Id             string
+	Questions      []string
+	Finished       bool
+	Channel        slack.Channel
+	Started        time.Time
+	Duration       time.Duration
+	config         ChannelConfig
+	templates      *Templates
+	localised      map[string]*Templates
+	localisedMutex sync.Mutex
+	logger         *Logger
+	client         *AuthedSlack
+	history        *History
+	userIds        []string
+	onLeave        []string
+	away           []string
+	excluded       []string
+	exclusions     map[string]string
+	userManager    *UserManager
+	// looked up once in Run, before anyone's asked, if the config needs them
+	userGroups  []userGroup
+	userReplies map[*User]userReply
+	completedAt map[*User]time.Time
+	answeredAt  map[*User][]string // Slack timestamps, by question
+	startsAt    map[*User]time.Time
+	closed      map[*User]bool
+	// people who've left the channel, whose goroutines might still report
+	// to us
+	left              map[string]bool
 	userRepliesMutex  sync.Mutex
+	clockStarted      time.Time
+	extension         time.Duration
+	clock             *time.Timer
+	timedOut          bool
+	finishReason      finishReason
 	finishedChan      chan struct{}
+	progressChan      chan struct{}
+	summaryTimestamp  string
+	usersTold         sync.WaitGroup
 	reportedWaitGroup *sync.WaitGroup
 }
 
+type finishReason string
+
+const (
+	finishAllAnswered finishReason = "all_answered"
+	finishTimedOut    finishReason = "timed_out"
+	finishEndedEarly  finishReason = "ended_early"
+	finishCancelled   finishReason = "cancelled"
+	finishInterrupted finishReason = "interrupted"
+)
+
 type userReply interface {
 	isUserReply()
 }
@@ -52,17 +90,36 @@ func (r userSkippedReply) isUserReply() {
 func (r userErrorReply) isUserReply() {
 }
 
-func NewStandup(client *AuthedSlack, channel slack.Channel, userManager *UserManager, reportedWaitGroup *sync.WaitGroup) (s *Standup) {
+func NewStandup(client *AuthedSlack, channel slack.Channel, userManager *UserManager, history *History, reportedWaitGroup *sync.WaitGroup) (s *Standup) {
 
 	reportedWaitGroup.Add(1)
 
+	started := time.Now()
+	id := fmt.Sprintf("%s-%d", channel.Id, started.Unix())
+	config := Settings.Channel(channel)
+	// we validated them on loading
+	templates, _ := Settings.Templates(config, config.Locale)
 	s = &Standup{
+		Id:                id,
 		client:            client,
 		Channel:           channel,
+		Started:           started,
+		config:            config,
+		templates:         templates,
+		localised:         make(map[string]*Templates),
+		logger:            Log.With("channel", channel.Name).With("standup_id", id),
 		userManager:       userManager,
+		history:           history,
 		userReplies:       make(map[*User]userReply),
-		Questions:         Questions,
+		completedAt:       make(map[*User]time.Time),
+		answeredAt:        make(map[*User][]string),
+		startsAt:          make(map[*User]time.Time),
+		closed:            make(map[*User]bool),
+		left:              make(map[string]bool),
+		exclusions:        make(map[string]string),
+		Questions:         templates.Questions,
 		finishedChan:      make(chan struct{}, 1),
+		progressChan:      make(chan struct{}, 1),
 		Duration:          StandupTimeMinutes * time.Minute,
 		reportedWaitGroup: reportedWaitGroup,
 	}
@@ -71,98 +128,388 @@ func NewStandup(client *AuthedSlack, channel slack.Channel, userManager *UserMan
 }
 
 func (self *Standup) Run() {
-	self.userIds = make([]string, 0, len(self.Channel.Members))
+	metricStandupsStarted.Inc("")
 
-	for _, userId := range self.Channel.Members {
-		if userId != self.client.UserId && self.userManager.StartStandup(self, userId) {
-			self.userIds = append(self.userIds, userId)
+	members := self.config.Members(self.Channel, self.userManager.directory)
+	if self.config.NeedsUserGroups() {
+		self.userGroups = self.userManager.directory.UserGroups()
+	}
+	userIds := make([]string, 0, len(members))
+	onLeave := make([]string, 0)
+	away := make([]string, 0)
+	excluded := make([]string, 0)
+	exclusions := make(map[string]string)
+
+	for i, start := range self.startMembers(members) {
+		userId := members[i]
+		switch start.result {
+		case standupStarted:
+			userIds = append(userIds, userId)
+		case standupUserOnLeave:
+			onLeave = append(onLeave, userId)
+		case standupUserAway:
+			away = append(away, userId)
+		case standupUserExcluded:
+			excluded = append(excluded, userId)
+			exclusions[userId] = start.reason
 		}
 	}
 
-	go self.startTheClock()
-
-	_ = <-self.finishedChan
+	self.userRepliesMutex.Lock()
+	// anyone who left while we were asking has already been let go
+	userIds, onLeave = self.withoutLeavers(userIds), self.withoutLeavers(onLeave)
+	away, excluded = self.withoutLeavers(away), self.withoutLeavers(excluded)
+	self.userIds, self.onLeave, self.away = userIds, onLeave, away
+	self.excluded, self.exclusions = excluded, exclusions
+	self.userRepliesMutex.Unlock()
+
+	self.logger.Infof("started; asking %d people, %d on leave, %d away and %d excluded",
+		len(userIds), len(onLeave), len(away), len(excluded))
+
+	self.startTheClock()
+
+	for finished := false; !finished; {
+		select {
+		case <-self.finishedChan:
+			finished = true
+		case <-self.progressChan:
+			self.postProgress()
+		}
+	}
 	self.Finished = true
-	DebugLog.Print("sending summary...")
 
-	var msg bytes.Buffer
+	// we're not done until everyone we were asking knows it's over, or we
+	// might exit before telling them
+	defer self.reportedWaitGroup.Done()
+	defer self.usersTold.Wait()
 
-	msg.WriteString("<!here>: *BARKBARKBARK Stand-up done!*\nQuestions were:\n")
-	for _, q := range self.Questions {
-		msg.WriteString("• ")
-		msg.WriteString(q)
-		msg.WriteString("\n")
+	if self.finishReason == finishCancelled {
+		self.logger.Infof("stand-up cancelled; not sending summary")
+		return
+	}
+
+	self.logger.Debugf("sending summary...")
+
+	rec := self.record()
+	msg := self.summaryMessage(true)
+	if self.history != nil && SummaryStreakMinimum > 0 {
+		if records, err := self.history.Load(); err == nil {
+			if footer := StreakFooter(records, rec, SummaryStreakMinimum, self.templates); footer != "" {
+				msg.addFooter(footer)
+			}
+		} else {
+			self.logger.Errorf("error loading history for streaks: %s", err)
+		}
+	}
+
+	err := self.postSummary(msg, true)
+	if err == nil {
+		self.logger.Infof("summary sent")
+		metricSummariesPosted.Inc("")
+		metricLastSummary.Set("", float64(time.Now().Unix()))
+	} else {
+		self.logger.Errorf("error posting summary: %s", err)
+		metricSummaryErrors.Inc("")
 	}
-	msg.WriteString("\n")
 
-	for user, anyReply := range self.userReplies {
-		userName := fmt.Sprintf("<@%s|%s>", user.Info.Id, user.Info.Name)
+	if self.history != nil {
+		if err = self.history.Append(rec); err != nil {
+			self.logger.Errorf("error recording stand-up history: %s", err)
+		}
+	}
+}
+
+/* startMembers asks everyone at once, or a few at a time in big channels,
+ * since looking people up can mean asking Slack about them. If we're stopped
+ * part way through, we don't bother asking the rest.
+ */
+func (self *Standup) startMembers(members []string) []standupStart {
+	results := make([]standupStart, len(members))
+	slots := make(chan struct{}, StandupStartConcurrency)
+	var wg sync.WaitGroup
+
+	for i, userId := range members {
+		if userId == self.client.UserId {
+			results[i] = standupStart{result: standupNotStarted}
+			continue
+		}
+		slots <- struct{}{}
+		if self.stopped() {
+			<-slots
+			results[i] = standupStart{result: standupNotStarted}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, userId string) {
+			defer wg.Done()
+			results[i] = self.userManager.StartStandup(self, userId)
+			<-slots
+		}(i, userId)
+	}
+	wg.Wait()
+	return results
+}
+
+/* In local mode people finish over the course of the day, so we post the
+ * summary as soon as the first of them does and keep it up to date.
+ */
+func (self *Standup) postProgress() {
+	if err := self.postSummary(self.summaryMessage(false), false); err != nil {
+		self.logger.Errorf("error posting summary so far: %s", err)
+	}
+}
+
+func (self *Standup) summary(final bool) string {
+	self.userRepliesMutex.Lock()
+	defer self.userRepliesMutex.Unlock()
+
+	interrupted := self.finishReason == finishInterrupted
+	data := summaryData{
+		Channel:     self.Channel.Name,
+		Questions:   self.Questions,
+		Final:       final,
+		Interrupted: interrupted,
+	}
+	section := func(name string, section sectionData) {
+		section.Interrupted = interrupted
+		data.Sections = append(data.Sections, self.templates.Render(name, section))
+	}
+
+	for _, user := range self.orderedUsers(final) {
+		anyReply := self.userReplies[user]
+		userName := fmt.Sprintf("<@%s|%s>", user.Info().Id, user.Info().Name)
 		switch reply := anyReply.(type) {
 		case userAnswersReply:
-			msg.WriteString(userName)
-			msg.WriteString(" answered:\n")
+			answered := sectionData{User: userName}
 			for _, a := range reply {
 				if a == "" {
-					msg.WriteString("but didn't respond to the rest.\n")
+					answered.Partial = true
 					break
 				}
-				msg.WriteString("• ")
-				msg.WriteString(a)
-				msg.WriteString("\n")
+				answered.Answers = append(answered.Answers, a)
 			}
+			answered.Took = self.tookText(user)
+			section(templateAnswered, answered)
 		case userAbsentReply:
-			msg.WriteString(userName)
-			msg.WriteString(" never replied to me :disappointed:")
+			section(templateAbsent, sectionData{User: userName})
 		case userSkippedReply:
-			msg.WriteString(userName)
-			msg.WriteString(" skipped this stand-up.")
+			section(templateSkipped, sectionData{User: userName})
 		case userErrorReply:
-			msg.WriteString("There was an error when trying to chat with ")
-			msg.WriteString(userName)
-		default:
-			msg.WriteString("I don't know what ")
-			msg.WriteString(userName)
-			msg.WriteString(" did. It is a mystery to me. :no_mouth:")
+			section(templateError, sectionData{User: userName})
 		}
-		msg.WriteString("\n")
 	}
 
-	var params slack.PostMessageParameters
+	for _, userId := range self.onLeave {
+		section(templateOnLeave, sectionData{User: fmt.Sprintf("<@%s>", userId)})
+	}
+	for _, userId := range self.away {
+		section(templateAway, sectionData{User: fmt.Sprintf("<@%s>", userId)})
+	}
+	for _, userId := range self.excluded {
+		section(templateExcluded, sectionData{User: fmt.Sprintf("<@%s>", userId),
+			Reason: self.exclusions[userId]})
+	}
+
+	return self.templates.Render(templateSummary, data)
+}
+
+// Templates returns what we say in a locale, or the channel's own if it's "".
+func (self *Standup) Templates(locale string) *Templates {
+	if locale == "" || locale == self.config.Locale {
+		return self.templates
+	}
+
+	self.localisedMutex.Lock()
+	defer self.localisedMutex.Unlock()
+	if t, ok := self.localised[locale]; ok {
+		return t
+	}
+	t, err := Settings.Templates(self.config, locale)
+	if err != nil {
+		// they chose it before the config changed
+		self.logger.With("locale", locale).Errorf("error using locale; using the channel's: %s", err)
+		t = self.templates
+	}
+	self.localised[locale] = t
+	return t
+}
+
+// Text renders one of the messages we send people about the stand-up.
+func (self *Standup) Text(locale, name string) string {
+	return self.Templates(locale).Render(name, dmData{Channel: self.Channel.Name})
+}
+
+// NagText renders the nth reminder.
+func (self *Standup) NagText(locale string, n int) string {
+	return self.Templates(locale).Nag(n, dmData{Channel: self.Channel.Name})
+}
+
+func (self *Standup) Question(locale string, i int) string {
+	return self.Templates(locale).Questions[i]
+}
+
+// Our channel messages contain user links we've formatted ourselves.
+func channelMessageParameters() (params slack.PostMessageParameters) {
 	params = DefaultMessageParameters
 	params.Parse = "none"
 	params.LinkNames = 0
 	params.EscapeText = false
+	return
+}
 
-	_, _, err := self.client.PostMessage(self.Channel.Id, msg.String(), params)
-	if err == nil {
-		DebugLog.Print("summary sent")
-	} else {
-		DebugLog.Printf("error posting summary: %s", err.Error())
+func (self *Standup) record() StandupRecord {
+	self.userRepliesMutex.Lock()
+	defer self.userRepliesMutex.Unlock()
+
+	r := StandupRecord{
+		Id:           self.Id,
+		ChannelId:    self.Channel.Id,
+		ChannelName:  self.Channel.Name,
+		Started:      self.Started,
+		Finished:     time.Now(),
+		Interrupted:  self.finishReason == finishInterrupted,
+		Questions:    self.Questions,
+		Participants: make([]ParticipantRecord, 0, len(self.userReplies)),
+	}
+
+	for _, user := range self.orderedUsers(true) {
+		anyReply := self.userReplies[user]
+		p := ParticipantRecord{
+			UserId:   user.Info().Id,
+			Name:     user.Info().Name,
+			RealName: user.Info().RealName,
+		}
+		if completed, ok := self.completedAt[user]; ok {
+			p.Completed = &completed
+		}
+		if started, ok := self.startsAt[user]; ok {
+			p.Started = &started
+		}
+		switch reply := anyReply.(type) {
+		case userAnswersReply:
+			p.Answers = []string(reply)
+			p.AnswerTimestamps = self.answeredAt[user]
+			if reply.isCompleted() {
+				p.Status = participantAnswered
+			} else {
+				p.Status = participantPartial
+			}
+		case userSkippedReply:
+			p.Status = participantSkipped
+		case userErrorReply:
+			p.Status = participantError
+		default:
+			p.Status = participantAbsent
+		}
+		r.Participants = append(r.Participants, p)
+	}
+	for _, userId := range self.onLeave {
+		r.Participants = append(r.Participants, ParticipantRecord{
+			UserId: userId,
+			Status: participantOnLeave,
+		})
+	}
+	for _, userId := range self.away {
+		r.Participants = append(r.Participants, ParticipantRecord{
+			UserId: userId,
+			Status: participantAway,
+		})
 	}
+	for _, userId := range self.excluded {
+		r.Participants = append(r.Participants, ParticipantRecord{
+			UserId: userId,
+			Status: participantExcluded,
+			Reason: self.exclusions[userId],
+		})
+	}
+
+	return r
+}
+
+/* tookText is how long someone took to answer everything, from when we
+ * started asking them, if the channel shows that and they did.
+ */
+// must be called holding userRepliesMutex
+func (self *Standup) tookText(u *User) string {
+	completed, ok := self.completedAt[u]
+	if !ok || !self.config.ShowTimes {
+		return ""
+	}
+	started := self.Started
+	if s, ok := self.startsAt[u]; ok {
+		started = s
+	}
+	return roundDuration(completed.Sub(started)).String()
+}
 
-	self.reportedWaitGroup.Done()
+func (self *Standup) userLogger(u *User) *Logger {
+	return self.logger.With("user_id", u.Info().Id)
 }
 
-func (self *Standup) ReportUserAcknowledged(u *User) {
+/* ReportUserAcknowledged is how users tell us they've got the stand-up. It
+ * returns false if it's been stopped since we asked them to it, in which case
+ * they should leave it be, since we'll never tell them it's over.
+ */
+func (self *Standup) ReportUserAcknowledged(u *User) bool {
 	self.userRepliesMutex.Lock()
 	defer self.userRepliesMutex.Unlock()
 
+	if self.finishReason != "" {
+		self.userLogger(u).Infof("finished before they were asked; not asking them")
+		return false
+	}
+	if self.left[u.Info().Id] {
+		self.userLogger(u).Infof("left before they were asked; not asking them")
+		return false
+	}
 	self.userReplies[u] = userAbsentReply{}
+	if self.config.StartMode == startModeLocal {
+		self.startsAt[u] = self.startTimeFor(u.Info(), time.Now())
+	}
 	// don't check for completion, we're only just starting
+	return true
+}
+
+// startTimeFor works out when someone will be asked, if we ask them now.
+func (self *Standup) startTimeFor(info slack.User, now time.Time) time.Time {
+	if self.config.StartMode != startModeLocal {
+		return now
+	}
+	return localStartTime(self.config.LocalStartTime, userLocation(info), now, self.Duration)
 }
 
-func (self *Standup) ReportUserAnswer(u *User, qidx int, answer string) {
+// StartTimeFor says when to ask someone; now, unless we're in local mode.
+func (self *Standup) StartTimeFor(u *User) time.Time {
 	self.userRepliesMutex.Lock()
 	defer self.userRepliesMutex.Unlock()
 
-	DebugLog.Printf("got answer from user %s: %s", u.Info.Name, answer)
+	return self.startsAt[u]
+}
+
+// ReportUserAnswer records an answer, and the timestamp of the message it came
+// in.
+func (self *Standup) ReportUserAnswer(u *User, qidx int, answer, timestamp string) {
+	self.userRepliesMutex.Lock()
+	defer self.userRepliesMutex.Unlock()
+
+	if self.ignoreLeaver(u) {
+		return
+	}
+	self.userLogger(u).With("question_idx", qidx).Debugf("got answer: %s", answer)
+	metricReplies.Inc("answer")
 	reply, replyExists := self.userReplies[u]
 	if _, isAbsent := reply.(userAbsentReply); !replyExists || isAbsent {
 		reply = make(userAnswersReply, len(self.Questions))
 		self.userReplies[u] = reply
+		self.answeredAt[u] = make([]string, len(self.Questions))
 	}
 	if answers, ok := reply.(userAnswersReply); ok {
 		answers[qidx] = answer
+		self.answeredAt[u][qidx] = timestamp
+		if answers.isCompleted() {
+			self.completedAt[u] = time.Now()
+			self.notifyProgress()
+		}
 	}
 
 	self.checkFinished()
@@ -172,7 +519,12 @@ func (self *Standup) ReportUserError(u *User) {
 	self.userRepliesMutex.Lock()
 	defer self.userRepliesMutex.Unlock()
 
+	if self.ignoreLeaver(u) {
+		return
+	}
 	self.userReplies[u] = userErrorReply{}
+	metricReplies.Inc("error")
+	self.notifyProgress()
 	self.checkFinished()
 }
 
@@ -180,51 +532,429 @@ func (self *Standup) ReportUserSkip(u *User) {
 	self.userRepliesMutex.Lock()
 	defer self.userRepliesMutex.Unlock()
 
+	if self.ignoreLeaver(u) {
+		return
+	}
 	self.userReplies[u] = userSkippedReply{}
+	metricReplies.Inc("skip")
+	self.notifyProgress()
 	self.checkFinished()
 }
 
+// ignoreLeaver says whether someone's left, so what they tell us is too late.
+// must hold userRepliesMutex
+func (self *Standup) ignoreLeaver(u *User) bool {
+	if !self.left[u.Info().Id] {
+		return false
+	}
+	self.userLogger(u).Debugf("left; ignoring what they told us")
+	return true
+}
+
+// must hold userRepliesMutex
+func (self *Standup) withoutLeavers(userIds []string) []string {
+	out := make([]string, 0, len(userIds))
+	for _, id := range userIds {
+		if !self.left[id] {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
 func (self *Standup) IsLastQuestion(i int) bool {
 	return i >= len(self.Questions)-1
 }
 
 func (self *Standup) startTheClock() {
-	time.Sleep(self.Duration)
+	self.userRepliesMutex.Lock()
+	defer self.userRepliesMutex.Unlock()
+
+	self.clockStarted = time.Now()
+	// everyone might have answered before we'd even finished asking
+	self.checkFinished()
+	self.scheduleTick()
+}
+
+/* Everyone has their own deadline. When we're asking everyone now, they're
+ * all the same; in local mode, they're each Duration after the person's
+ * own start time.
+ */
+// must hold userRepliesMutex
+func (self *Standup) deadlineFor(u *User) time.Time {
+	start, ok := self.startsAt[u]
+	if !ok {
+		start = self.clockStarted
+	}
+	return start.Add(self.Duration + self.extension)
+}
 
+// DeadlineFor says when someone's time is up. Until we've finished asking
+// everyone and started the clock, it's as if we'd started it now.
+func (self *Standup) DeadlineFor(u *User) time.Time {
 	self.userRepliesMutex.Lock()
 	defer self.userRepliesMutex.Unlock()
 
-	for user, _ := range self.userReplies {
-		user.StandupTimeUp(self)
+	if _, ok := self.startsAt[u]; !ok && self.clockStarted.IsZero() {
+		return time.Now().Add(self.Duration + self.extension)
 	}
+	return self.deadlineFor(u)
+}
 
-	self.finish()
+// must hold userRepliesMutex
+func (self *Standup) deadline() time.Time {
+	deadline := self.clockStarted.Add(self.Duration + self.extension)
+	for user := range self.userReplies {
+		if d := self.deadlineFor(user); d.After(deadline) {
+			deadline = d
+		}
+	}
+	// people's start times are in their own timezones, but we report ours
+	return deadline.Local()
 }
 
-func (self *Standup) finish() {
-	DebugLog.Print("finishing standup...")
-	self.finishedChan <- struct{}{}
+// must hold userRepliesMutex
+func (self *Standup) scheduleTick() {
+	if self.finishReason != "" {
+		return
+	}
+
+	next := self.deadline()
+	for user := range self.userReplies {
+		if d := self.deadlineFor(user); !self.closed[user] && d.Before(next) {
+			next = d
+		}
+	}
+
+	wait := next.Sub(time.Now())
+	if self.clock == nil {
+		self.clock = time.AfterFunc(wait, self.tick)
+	} else {
+		self.clock.Reset(wait)
+	}
 }
 
-func (self *Standup) isFinished() bool {
-	if len(self.userIds) != len(self.userReplies) {
+func (self *Standup) tick() {
+	self.userRepliesMutex.Lock()
+	defer self.userRepliesMutex.Unlock()
+
+	if self.finishReason != "" {
+		return
+	}
+
+	now := time.Now()
+	for user := range self.userReplies {
+		if !self.closed[user] && !now.Before(self.deadlineFor(user)) {
+			self.closeUser(user)
+		}
+	}
+
+	self.checkFinished()
+	if !now.Before(self.deadline()) {
+		self.stop(finishTimedOut)
+		return
+	}
+	self.scheduleTick()
+}
+
+// must hold userRepliesMutex
+func (self *Standup) closeUser(u *User) {
+	self.closed[u] = true
+	if !self.isDone(u) {
+		self.timedOut = true
+		self.notifyProgress()
+	}
+	// users may be waiting on this lock to report an answer, so don't
+	// block on them here
+	self.usersTold.Add(1)
+	go u.StandupTimeUp(self, self.finishReason)
+}
+
+/* AddMember asks someone who's joined the channel since we started, as long
+ * as there's time for them to answer.
+ */
+func (self *Standup) AddMember(userId string) {
+	// a roster doesn't change with the channel
+	if len(self.config.Roster) > 0 {
+		return
+	}
+
+	self.userRepliesMutex.Lock()
+	if self.finishReason != "" || self.clockStarted.IsZero() || self.isMember(userId) {
+		self.userRepliesMutex.Unlock()
+		return
+	}
+	logger := self.logger.With("user_id", userId)
+	if left := self.deadline().Sub(time.Now()); left < StandupJoinMinimumMinutes*time.Minute {
+		self.userRepliesMutex.Unlock()
+		logger.Infof("joined with only %s left; not asking them", left)
+		return
+	}
+	// we mustn't finish while they're being asked
+	self.userIds = append(self.userIds, userId)
+	delete(self.left, userId)
+	self.userRepliesMutex.Unlock()
+
+	logger.Infof("joined; asking them too")
+	start := self.userManager.StartStandup(self, userId)
+
+	self.userRepliesMutex.Lock()
+	defer self.userRepliesMutex.Unlock()
+
+	if start.result == standupStarted {
+		return
+	}
+	self.userIds = removeUserId(self.userIds, userId)
+	switch start.result {
+	case standupUserOnLeave:
+		self.onLeave = append(self.onLeave, userId)
+	case standupUserAway:
+		self.away = append(self.away, userId)
+	case standupUserExcluded:
+		self.excluded = append(self.excluded, userId)
+		self.exclusions[userId] = start.reason
+	}
+	self.checkFinished()
+}
+
+/* RemoveMember stops waiting on someone who's left the channel. Anything
+ * they'd finished telling us still goes in the summary.
+ */
+func (self *Standup) RemoveMember(userId string) {
+	if len(self.config.Roster) > 0 {
+		return
+	}
+
+	self.userRepliesMutex.Lock()
+	defer self.userRepliesMutex.Unlock()
+
+	if self.finishReason != "" {
+		return
+	}
+	for user := range self.userReplies {
+		if user.Info().Id == userId {
+			if self.isDone(user) {
+				return
+			}
+			delete(self.userReplies, user)
+			delete(self.completedAt, user)
+			delete(self.answeredAt, user)
+			delete(self.startsAt, user)
+			delete(self.closed, user)
+			go user.LeftStandup(self)
+		}
+	}
+	self.left[userId] = true
+	self.userIds = removeUserId(self.userIds, userId)
+	self.onLeave = removeUserId(self.onLeave, userId)
+	self.away = removeUserId(self.away, userId)
+	self.excluded = removeUserId(self.excluded, userId)
+
+	self.logger.With("user_id", userId).Infof("left; not waiting on them")
+	self.checkFinished()
+}
+
+// must hold userRepliesMutex
+func (self *Standup) isMember(userId string) bool {
+	for _, ids := range [][]string{self.userIds, self.onLeave, self.away, self.excluded} {
+		for _, id := range ids {
+			if id == userId {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func removeUserId(userIds []string, userId string) []string {
+	out := make([]string, 0, len(userIds))
+	for _, id := range userIds {
+		if id != userId {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// ReportUserTold is how users let us know they've dealt with time being up.
+func (self *Standup) ReportUserTold(u *User) {
+	self.usersTold.Done()
+}
+
+// End finishes the stand-up now and posts the summary of what we've got.
+func (self *Standup) End() bool {
+	self.userRepliesMutex.Lock()
+	defer self.userRepliesMutex.Unlock()
+
+	return self.stop(finishEndedEarly)
+}
+
+// Cancel aborts the stand-up without posting anything to the channel.
+func (self *Standup) Cancel() bool {
+	self.userRepliesMutex.Lock()
+	defer self.userRepliesMutex.Unlock()
+
+	return self.stop(finishCancelled)
+}
+
+// Interrupt finishes the stand-up now because we're shutting down, and posts
+// what we've got.
+func (self *Standup) Interrupt() bool {
+	self.userRepliesMutex.Lock()
+	defer self.userRepliesMutex.Unlock()
+
+	return self.stop(finishInterrupted)
+}
+
+// Extend pushes back the deadline, returning the new one.
+func (self *Standup) Extend(d time.Duration) (deadline time.Time, ok bool) {
+	self.userRepliesMutex.Lock()
+	defer self.userRepliesMutex.Unlock()
+
+	if self.finishReason != "" || self.clock == nil {
+		return self.deadline(), false
+	}
+	self.extension += d
+	self.scheduleTick()
+	return self.deadline(), true
+}
+
+func (self *Standup) Deadline() time.Time {
+	self.userRepliesMutex.Lock()
+	defer self.userRepliesMutex.Unlock()
+
+	return self.deadline()
+}
+
+// must hold userRepliesMutex
+func (self *Standup) stop(reason finishReason) bool {
+	if self.finishReason != "" {
 		return false
 	}
-	for _, reply := range self.userReplies {
-		switch r := reply.(type) {
+	if self.clock != nil {
+		self.clock.Stop()
+	}
+
+	self.finish(reason)
+
+	for user := range self.userReplies {
+		if !self.closed[user] {
+			self.closeUser(user)
+		}
+	}
+	return true
+}
+
+func (self *Standup) stopped() bool {
+	self.userRepliesMutex.Lock()
+	defer self.userRepliesMutex.Unlock()
+
+	return self.finishReason != ""
+}
+
+// must hold userRepliesMutex
+func (self *Standup) notifyProgress() {
+	if self.config.StartMode != startModeLocal || self.finishReason != "" {
+		return
+	}
+	select {
+	case self.progressChan <- struct{}{}:
+	default:
+		// there's already an update on its way
+	}
+}
+
+// must hold userRepliesMutex
+func (self *Standup) finish(reason finishReason) {
+	self.logger.Infof("finishing stand-up (%s)", reason)
+	self.finishReason = reason
+	metricStandupsFinished.Inc(string(reason))
+	self.finishedChan <- struct{}{}
+}
+
+// Missing returns the people who haven't finished yet, in the summary's
+// order.
+func (self *Standup) Missing() (users []*User) {
+	self.userRepliesMutex.Lock()
+	defer self.userRepliesMutex.Unlock()
+
+	for _, user := range self.orderedUsers(true) {
+		switch reply := self.userReplies[user].(type) {
+		case userAbsentReply:
+			users = append(users, user)
+		case userAnswersReply:
+			if !reply.isCompleted() {
+				users = append(users, user)
+			}
+		}
+	}
+	return
+}
+
+// Progress describes where each person has got to, for the status command.
+func (self *Standup) Progress(replies *Replies) string {
+	self.userRepliesMutex.Lock()
+	defer self.userRepliesMutex.Unlock()
+
+	data := statusData{Channel: self.Channel.Name, Started: self.Started, Ends: self.deadline()}
+	// in the same order as the summary
+	for _, user := range self.orderedUsers(true) {
+		anyReply := self.userReplies[user]
+		person := statusPersonData{User: fmt.Sprintf("<@%s|%s>", user.Info().Id, user.Info().Name)}
+		switch reply := anyReply.(type) {
 		case userAnswersReply:
-			if !r.isCompleted() {
-				return false
+			for _, a := range reply {
+				if a != "" {
+					person.Answered++
+				}
 			}
+			person.Questions = len(reply)
 		case userAbsentReply:
+			person.Absent = true
+		case userSkippedReply:
+			person.Skipped = true
+		case userErrorReply:
+			person.Error = true
+		}
+		data.People = append(data.People, person)
+	}
+	return replies.Render(replyAdminStatus, data)
+}
+
+// must hold userRepliesMutex
+func (self *Standup) isDone(u *User) bool {
+	switch r := self.userReplies[u].(type) {
+	case userAnswersReply:
+		return r.isCompleted()
+	case userAbsentReply:
+		return false
+	}
+	return true
+}
+
+// must hold userRepliesMutex
+func (self *Standup) isFinished() bool {
+	if self.clockStarted.IsZero() || len(self.userIds) != len(self.userReplies) {
+		return false
+	}
+	for user := range self.userReplies {
+		if !self.closed[user] && !self.isDone(user) {
 			return false
 		}
 	}
 	return true
 }
 
+// must hold userRepliesMutex
 func (self *Standup) checkFinished() {
-	if self.isFinished() {
-		self.finish()
+	if self.finishReason == "" && self.isFinished() {
+		if self.clock != nil {
+			self.clock.Stop()
+		}
+		if self.timedOut {
+			self.finish(finishTimedOut)
+		} else {
+			self.finish(finishAllAnswered)
+		}
 	}
 }
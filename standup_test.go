@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/abourget/slack"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStandupStoppedWhileAsking(t *testing.T) {
+	b := newTestBot(t, slack.User{Id: "U1", Name: "bob"}, slack.User{Id: "U2", Name: "amy"})
+	defer b.Close()
+
+	release := b.slack.hold("im.open")
+	defer release()
+	s, err := b.standups.Start(testChannel("C1", "design", "U1", "U2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// they've been looked up, but haven't got the stand-up yet
+	waitFor(t, "IMs to be opened", func() bool { return b.slack.Calls("im.open") == 2 })
+	if !s.End() {
+		t.Fatal("couldn't end the stand-up")
+	}
+	release()
+	b.waitReported(t)
+
+	for _, userId := range []string{"U1", "U2"} {
+		if dms := b.slack.DMs(userId); len(dms) > 0 {
+			t.Errorf("%s was asked to a stand-up that had ended: %q", userId, dms)
+		}
+	}
+
+	// and they're free for the next one
+	b.start(t, testChannel("C2", "ops", "U1", "U2"), "U1", "U2")
+}
+
+func TestShutdownWhileAsking(t *testing.T) {
+	// more than we look up at once, so we stop part way through
+	var users []slack.User
+	var members []string
+	for i := 0; i < StandupStartConcurrency+2; i++ {
+		id := fmt.Sprintf("U%d", i)
+		users = append(users, slack.User{Id: id, Name: strings.ToLower(id)})
+		members = append(members, id)
+	}
+	b := newTestBot(t, users...)
+	defer b.Close()
+
+	release := b.slack.hold("im.open")
+	defer release()
+	if _, err := b.standups.Start(testChannel("C1", "design", members...)); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "IMs to be opened", func() bool { return b.slack.Calls("im.open") == StandupStartConcurrency })
+	if n := b.standups.Shutdown(); n != 1 {
+		t.Fatalf("shut down %d stand-ups; want 1", n)
+	}
+	release()
+	b.waitReported(t)
+
+	for _, userId := range members {
+		if dms := b.slack.DMs(userId); len(dms) > 0 {
+			t.Errorf("%s was asked to a stand-up that was shut down: %q", userId, dms)
+		}
+	}
+	if n := b.slack.Calls("im.open"); n != StandupStartConcurrency {
+		t.Errorf("opened %d IMs; want to stop looking people up", n)
+	}
+	if _, err := b.standups.Start(testChannel("C2", "ops", "U1")); err != errShuttingDown {
+		t.Errorf("got %v starting another; want %v", err, errShuttingDown)
+	}
+}
+
+func TestFinalSummaryIsANewMessage(t *testing.T) {
+	defer func(settings *Config) { Settings = settings }(Settings)
+	// so we ask them straight away, wherever the clock is
+	now := time.Now().UTC().Format(localTimeFormat)
+	Settings = &Config{Defaults: []byte(`{"start_mode": "local", "local_start_time": "` + now + `"}`)}
+
+	b := newTestBot(t, slack.User{Id: "U1", Name: "bob", TZ: "UTC"}, slack.User{Id: "U2", Name: "amy", TZ: "UTC"})
+	defer b.Close()
+
+	s := b.start(t, testChannel("C1", "design", "U1", "U2"), "U1", "U2")
+	for _, q := range Questions {
+		b.say("U1", q)
+	}
+	waitFor(t, "the summary so far", func() bool { return len(b.slack.ChannelPosts("C1")) > 0 })
+	progress := b.slack.ChannelPosts("C1")[0]
+	if strings.Contains(progress.Text, "<!here>") {
+		t.Errorf("the summary so far mentions @here: %q", progress.Text)
+	}
+
+	s.End()
+	b.waitReported(t)
+	posts := b.slack.ChannelPosts("C1")
+	if len(posts) < 3 {
+		t.Fatalf("want the summary so far, the final one and a deletion; got %+v", posts)
+	}
+	final := posts[len(posts)-2]
+	if final.Method != "chat.postMessage" || !strings.HasPrefix(final.Text, "<!here>") {
+		t.Errorf("want a new message for the final summary, mentioning @here; got %+v", final)
+	}
+	if deleted := posts[len(posts)-1]; deleted.Method != "chat.delete" || deleted.Ts != progress.Ts {
+		t.Errorf("want the summary so far, %s, deleted; got %+v", progress.Ts, deleted)
+	}
+}
+
+// asked is whoever with this id we're asking, or have asked.
+func asked(s *Standup, userId string) *User {
+	s.userRepliesMutex.Lock()
+	defer s.userRepliesMutex.Unlock()
+	for u := range s.userReplies {
+		if u.Info().Id == userId {
+			return u
+		}
+	}
+	return nil
+}
+
+func answerAll(b *testBot, userId string) {
+	for _, q := range Questions {
+		b.say(userId, q)
+	}
+}
+
+func TestMemberJoins(t *testing.T) {
+	b := newTestBot(t, slack.User{Id: "U1", Name: "bob"}, slack.User{Id: "U2", Name: "amy"})
+	defer b.Close()
+
+	s := b.start(t, testChannel("C1", "design", "U1"), "U1")
+	b.standups.MemberJoined("C1", "U2")
+	b.slack.waitForDM(t, "U2", Questions[0])
+	answerAll(b, "U1")
+	answerAll(b, "U2")
+	b.waitReported(t)
+
+	if s.finishReason != finishAllAnswered || len(s.record().Participants) != 2 {
+		t.Errorf("finished because %s with %d people; want everyone to answer, amy too", s.finishReason, len(s.record().Participants))
+	}
+}
+
+func TestMemberJoinsTooLate(t *testing.T) {
+	b := newTestBot(t, slack.User{Id: "U1", Name: "bob"}, slack.User{Id: "U2", Name: "amy"})
+	defer b.Close()
+
+	s := b.start(t, testChannel("C1", "design", "U1"), "U1")
+	s.userRepliesMutex.Lock()
+	s.clockStarted = s.clockStarted.Add(-(StandupTimeMinutes - StandupJoinMinimumMinutes + 1) * time.Minute)
+	s.userRepliesMutex.Unlock()
+
+	b.standups.MemberJoined("C1", "U2")
+	answerAll(b, "U1")
+	b.waitReported(t)
+
+	if dms := b.slack.DMs("U2"); len(dms) > 0 {
+		t.Errorf("amy was asked with too little time left: %q", dms)
+	}
+	if s.finishReason != finishAllAnswered {
+		t.Errorf("finished because %s; want bob's answers to be enough", s.finishReason)
+	}
+}
+
+func TestMemberLeaves(t *testing.T) {
+	b := newTestBot(t, slack.User{Id: "U1", Name: "bob"}, slack.User{Id: "U2", Name: "amy"})
+	defer b.Close()
+
+	s := b.start(t, testChannel("C1", "design", "U1", "U2"), "U1", "U2")
+	amy := asked(s, "U2")
+	b.standups.MemberLeft("C1", "U2")
+	// she answered just as she left
+	s.ReportUserAnswer(amy, 0, "too late", "1.000001")
+	answerAll(b, "U1")
+	b.waitReported(t)
+
+	if s.finishReason != finishAllAnswered {
+		t.Errorf("finished because %s; want bob's answers to be enough", s.finishReason)
+	}
+	if participants := s.record().Participants; len(participants) != 1 || participants[0].UserId != "U1" {
+		t.Errorf("got %+v; want only bob", participants)
+	}
+}
+
+func TestMemberLeavesAfterFinishing(t *testing.T) {
+	b := newTestBot(t, slack.User{Id: "U1", Name: "bob"}, slack.User{Id: "U2", Name: "amy"})
+	defer b.Close()
+
+	s := b.start(t, testChannel("C1", "design", "U1", "U2"), "U1", "U2")
+	answerAll(b, "U2")
+	b.slack.waitForDM(t, "U2", UserStandupEndText)
+	b.standups.MemberLeft("C1", "U2")
+	answerAll(b, "U1")
+	b.waitReported(t)
+
+	if participants := s.record().Participants; len(participants) != 2 {
+		t.Errorf("got %+v; want amy's answers kept", participants)
+	}
+}
+
+func TestMemberLeavesWhileAsking(t *testing.T) {
+	b := newTestBot(t, slack.User{Id: "U1", Name: "bob"}, slack.User{Id: "U2", Name: "amy"})
+	defer b.Close()
+
+	release := b.slack.hold("im.open")
+	defer release()
+	s, err := b.standups.Start(testChannel("C1", "design", "U1", "U2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "IMs to be opened", func() bool { return b.slack.Calls("im.open") == 2 })
+	b.standups.MemberLeft("C1", "U2")
+	release()
+	b.slack.waitForDM(t, "U1", Questions[0])
+	answerAll(b, "U1")
+	b.waitReported(t)
+
+	if s.finishReason != finishAllAnswered {
+		t.Errorf("finished because %s; want bob's answers to be enough", s.finishReason)
+	}
+	if countOf(b.slack.DMs("U2"), Questions[0]) > 0 {
+		t.Error("amy was asked after she'd left")
+	}
+}
+
+func TestRosterMembersComeAndGo(t *testing.T) {
+	defer func(settings *Config) { Settings = settings }(Settings)
+	Settings = &Config{Channels: map[string]json.RawMessage{
+		"design": json.RawMessage(`{"roster": ["bob", "amy"]}`),
+	}}
+	b := newTestBot(t,
+		slack.User{Id: "U1", Name: "bob"},
+		slack.User{Id: "U2", Name: "amy"},
+		slack.User{Id: "U3", Name: "cat"})
+	defer b.Close()
+
+	s := b.start(t, testChannel("C1", "design", "U1", "U2"), "U1", "U2")
+	// the roster says who's asked, not the channel
+	b.standups.MemberJoined("C1", "U3")
+	b.standups.MemberLeft("C1", "U2")
+	answerAll(b, "U1")
+	b.slack.waitForDM(t, "U1", UserStandupEndText)
+
+	s.userRepliesMutex.Lock()
+	userIds, reason := append([]string(nil), s.userIds...), s.finishReason
+	s.userRepliesMutex.Unlock()
+	if !equalStrings(userIds, []string{"U1", "U2"}) || reason != "" {
+		t.Errorf("asking %q, finished %q; want to still be waiting on amy", userIds, reason)
+	}
+	if dms := b.slack.DMs("U3"); len(dms) > 0 {
+		t.Errorf("cat was asked, though she's not on the roster: %q", dms)
+	}
+	answerAll(b, "U2")
+	b.waitReported(t)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"github.com/abourget/slack"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var errStandupAlreadyRunning = errors.New("stand-up already running")
+var errShuttingDown = errors.New("shutting down")
+
+/* StandupManager keeps track of the stand-ups that are running, so they can
+ * be found again by channel once started, and starts new ones on request.
+ */
+type StandupManager struct {
+	client            *AuthedSlack
+	userManager       *UserManager
+	history           *History
+	reportedWaitGroup *sync.WaitGroup
+	running           map[string]*Standup
+	shuttingDown      bool
+	runningMutex      sync.Mutex
+}
+
+func NewStandupManager(client *AuthedSlack, userManager *UserManager, history *History, reportedWaitGroup *sync.WaitGroup) (sm *StandupManager) {
+	sm = &StandupManager{
+		client:            client,
+		userManager:       userManager,
+		history:           history,
+		reportedWaitGroup: reportedWaitGroup,
+		running:           make(map[string]*Standup),
+	}
+	// users need to get back to us for admin commands
+	userManager.standups = sm
+	return
+}
+
+// We run stand-ups in every channel we've been invited to, bar #general.
+func isStandupChannel(ch slack.Channel) bool {
+	return ch.IsMember && !ch.IsGeneral
+}
+
+func (self *StandupManager) Start(ch slack.Channel) (s *Standup, err error) {
+	self.runningMutex.Lock()
+	defer self.runningMutex.Unlock()
+
+	if self.shuttingDown {
+		return nil, errShuttingDown
+	}
+	if _, ok := self.running[ch.Id]; ok {
+		return nil, errStandupAlreadyRunning
+	}
+
+	s = NewStandup(self.client, ch, self.userManager, self.history, self.reportedWaitGroup)
+	self.running[ch.Id] = s
+	go func() {
+		s.Run()
+		self.runningMutex.Lock()
+		delete(self.running, ch.Id)
+		self.runningMutex.Unlock()
+	}()
+	return s, nil
+}
+
+// Shutdown stops any more stand-ups starting and interrupts the ones that
+// are running, returning how many there were.
+func (self *StandupManager) Shutdown() int {
+	self.runningMutex.Lock()
+	defer self.runningMutex.Unlock()
+
+	self.shuttingDown = true
+	for _, s := range self.running {
+		s.Interrupt()
+	}
+	return len(self.running)
+}
+
+func (self *StandupManager) Running(channelId string) *Standup {
+	self.runningMutex.Lock()
+	defer self.runningMutex.Unlock()
+
+	return self.running[channelId]
+}
+
+// MemberJoined asks someone who's joined a channel to the stand-up running
+// there, if there is one.
+func (self *StandupManager) MemberJoined(channelId, userId string) {
+	if s := self.Running(channelId); s != nil {
+		s.AddMember(userId)
+	}
+}
+
+// MemberLeft stops a stand-up waiting on someone who's left its channel.
+func (self *StandupManager) MemberLeft(channelId, userId string) {
+	if s := self.Running(channelId); s != nil {
+		s.RemoveMember(userId)
+	}
+}
+
+// All returns the running stand-ups, ordered by channel name.
+func (self *StandupManager) All() []*Standup {
+	self.runningMutex.Lock()
+	defer self.runningMutex.Unlock()
+
+	out := make([]*Standup, 0, len(self.running))
+	for _, s := range self.running {
+		out = append(out, s)
+	}
+	sort.Sort(standupsByChannelName(out))
+	return out
+}
+
+// FindChannel resolves a channel by id or name, in any of the forms people
+// might type one in a message: <#C1234|design>, <#C1234>, #design or design.
+func (self *StandupManager) FindChannel(ref string) (*slack.Channel, error) {
+	ref = strings.TrimSuffix(strings.TrimPrefix(ref, "<"), ">")
+	ref = strings.TrimPrefix(ref, "#")
+	if i := strings.Index(ref, "|"); i >= 0 {
+		ref = ref[:i]
+	}
+
+	chs, err := self.client.GetChannels(true)
+	if err != nil {
+		return nil, err
+	}
+	for _, ch := range chs {
+		if ch.Id == ref || strings.EqualFold(ch.Name, ref) {
+			return &ch, nil
+		}
+	}
+	return nil, nil
+}
+
+type standupsByChannelName []*Standup
+
+func (ss standupsByChannelName) Len() int           { return len(ss) }
+func (ss standupsByChannelName) Less(i, j int) bool { return ss[i].Channel.Name < ss[j].Channel.Name }
+func (ss standupsByChannelName) Swap(i, j int)      { ss[i], ss[j] = ss[j], ss[i] }
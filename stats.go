@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const statsDateFormat = "2006-01-02"
+
+type ParticipationStats struct {
+	Asked         int
+	Answered      int
+	Partial       int
+	Skipped       int
+	Absent        int
+	Errored       int
+	Streak        int
+	LongestStreak int
+	completeTotal time.Duration
+	completeCount int
+	completions   []time.Duration
+	latencyTotals []time.Duration
+	latencyCounts []int
+}
+
+func (self *ParticipationStats) add(rec StandupRecord, p ParticipantRecord) {
+	if !p.Asked() {
+		return
+	}
+	self.Asked++
+	switch p.Status {
+	case participantAnswered:
+		self.Answered++
+	case participantPartial:
+		self.Partial++
+	case participantSkipped:
+		self.Skipped++
+	case participantError:
+		self.Errored++
+	default:
+		self.Absent++
+	}
+	started := rec.Started
+	if p.Started != nil {
+		started = *p.Started
+	}
+	if p.Completed != nil && p.Completed.After(started) {
+		self.completeTotal += p.Completed.Sub(started)
+		self.completeCount++
+		self.completions = append(self.completions, p.Completed.Sub(started))
+	}
+	for qidx := range p.Answers {
+		latency, ok := p.Latency(rec, qidx)
+		if !ok {
+			continue
+		}
+		for len(self.latencyTotals) <= qidx {
+			self.latencyTotals = append(self.latencyTotals, 0)
+			self.latencyCounts = append(self.latencyCounts, 0)
+		}
+		self.latencyTotals[qidx] += latency
+		self.latencyCounts[qidx]++
+	}
+}
+
+// ResponseRate is the proportion of stand-ups that got at least one answer.
+func (self ParticipationStats) ResponseRate() float64 {
+	return rate(self.Answered+self.Partial, self.Asked)
+}
+
+// AverageTimeToComplete is measured from when we started asking to the last
+// answer, for stand-ups that were answered in full.
+func (self ParticipationStats) AverageTimeToComplete() time.Duration {
+	if self.completeCount == 0 {
+		return 0
+	}
+	return self.completeTotal / time.Duration(self.completeCount)
+}
+
+// CompletedWithin is the proportion of stand-ups answered in full that were
+// finished within d of our asking.
+func (self ParticipationStats) CompletedWithin(d time.Duration) float64 {
+	n := 0
+	for _, took := range self.completions {
+		if took <= d {
+			n++
+		}
+	}
+	return rate(n, len(self.completions))
+}
+
+/* AverageLatencies are how long people take to answer each question, by
+ * question, from when we ask it. They're only known for answers recorded with
+ * their timestamps, so they're zero for questions nobody has.
+ */
+func (self ParticipationStats) AverageLatencies() []time.Duration {
+	averages := make([]time.Duration, len(self.latencyTotals))
+	for i, total := range self.latencyTotals {
+		if self.latencyCounts[i] > 0 {
+			averages[i] = total / time.Duration(self.latencyCounts[i])
+		}
+	}
+	return averages
+}
+
+func UserStats(records []StandupRecord, userId string) (stats ParticipationStats) {
+	respondedByDate := make(map[string]bool)
+
+	for _, rec := range records {
+		for _, p := range rec.Participants {
+			if p.UserId != userId || !p.Asked() {
+				continue
+			}
+			stats.add(rec, p)
+			date := rec.Started.Local().Format(statsDateFormat)
+			respondedByDate[date] = respondedByDate[date] || p.Responded()
+		}
+	}
+
+	stats.Streak, stats.LongestStreak = streaks(respondedByDate)
+	return
+}
+
+func ChannelStats(records []StandupRecord, channelId string) (stats ParticipationStats) {
+	for _, rec := range records {
+		if rec.ChannelId != channelId {
+			continue
+		}
+		for _, p := range rec.Participants {
+			stats.add(rec, p)
+		}
+	}
+	return
+}
+
+/* A streak counts the days someone was asked and answered, one after another.
+ * Days they weren't asked at all, like weekends, don't break it; days they
+ * were asked and didn't answer do.
+ */
+func streaks(respondedByDate map[string]bool) (current int, longest int) {
+	dates := make([]string, 0, len(respondedByDate))
+	for d := range respondedByDate {
+		dates = append(dates, d)
+	}
+	sort.Strings(dates)
+
+	for _, d := range dates {
+		if respondedByDate[d] {
+			current++
+			if current > longest {
+				longest = current
+			}
+		} else {
+			current = 0
+		}
+	}
+	return
+}
+
+// StreakFooter congratulates everyone in the current stand-up whose streak has
+// reached the minimum, in the channel's words.
+func StreakFooter(records []StandupRecord, current StandupRecord, minimum int, templates *Templates) string {
+	var msg bytes.Buffer
+	all := append(records, current)
+
+	for _, p := range current.Participants {
+		if !p.Responded() {
+			continue
+		}
+		if stats := UserStats(all, p.UserId); stats.Streak >= minimum {
+			msg.WriteString(strings.TrimSpace(templates.Render(templateStreak, streakData{
+				User: fmt.Sprintf("<@%s|%s>", p.UserId, p.Name),
+				Days: stats.Streak,
+			})))
+			msg.WriteString("\n")
+		}
+	}
+	return msg.String()
+}
+
+func (self ParticipationStats) Describe(replies *Replies) string {
+	if self.Asked == 0 {
+		return replies.Render(replyNoStats, nil)
+	}
+
+	data := statsData{
+		Asked:         self.Asked,
+		Answered:      self.Answered,
+		Partial:       self.Partial,
+		Skipped:       self.Skipped,
+		Missed:        self.Absent + self.Errored,
+		Rate:          int(self.ResponseRate()*100 + 0.5),
+		Streak:        self.Streak,
+		LongestStreak: self.LongestStreak,
+	}
+	if avg := self.AverageTimeToComplete(); avg > 0 {
+		data.Average = roundDuration(avg).String()
+	}
+	return replies.Render(replyStats, data)
+}
+
+func roundDuration(d time.Duration) time.Duration {
+	if d > time.Minute {
+		return d - d%time.Minute
+	}
+	return d - d%time.Second
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func standupOn(date string, participants ...ParticipantRecord) StandupRecord {
+	started, err := time.ParseInLocation(statsDateFormat, date, time.Local)
+	if err != nil {
+		panic(err)
+	}
+	started = started.Add(9*time.Hour + 30*time.Minute)
+	return StandupRecord{Id: "C1-" + date, ChannelId: "C1", Started: started, Participants: participants}
+}
+
+func participant(userId, status string) ParticipantRecord {
+	return ParticipantRecord{UserId: userId, Name: strings.ToLower(userId), Status: status}
+}
+
+func TestStreaks(t *testing.T) {
+	tests := []struct {
+		responded        map[string]bool
+		current, longest int
+	}{
+		{map[string]bool{}, 0, 0},
+		{map[string]bool{"2026-10-16": true, "2026-10-19": true}, 2, 2},
+		{map[string]bool{"2026-10-14": true, "2026-10-15": true, "2026-10-16": false, "2026-10-19": true}, 1, 2},
+		{map[string]bool{"2026-10-15": true, "2026-10-16": true, "2026-10-19": false}, 0, 2},
+	}
+	for _, test := range tests {
+		current, longest := streaks(test.responded)
+		if current != test.current || longest != test.longest {
+			t.Errorf("streaks(%v) = %d, %d; want %d, %d", test.responded, current, longest, test.current, test.longest)
+		}
+	}
+}
+
+func TestUserStats(t *testing.T) {
+	records := []StandupRecord{
+		standupOn("2026-10-12", participant("U1", participantAnswered)),
+		standupOn("2026-10-13", participant("U1", participantAbsent)),
+		// days they weren't asked don't break a streak
+		standupOn("2026-10-14", participant("U1", participantOnLeave)),
+		standupOn("2026-10-15", participant("U1", participantPartial), participant("U2", participantSkipped)),
+		standupOn("2026-10-16", participant("U1", participantAnswered)),
+		standupOn("2026-10-19", participant("U2", participantAnswered)),
+	}
+
+	stats := UserStats(records, "U1")
+	if stats.Asked != 4 || stats.Answered != 2 || stats.Partial != 1 || stats.Absent != 1 {
+		t.Errorf("got %+v; want 4 asked, 2 answered, 1 partly and 1 absent", stats)
+	}
+	if stats.ResponseRate() != 0.75 {
+		t.Errorf("got a response rate of %f; want 0.75", stats.ResponseRate())
+	}
+	if stats.Streak != 2 || stats.LongestStreak != 2 {
+		t.Errorf("got a streak of %d, at best %d; want 2 and 2", stats.Streak, stats.LongestStreak)
+	}
+
+	if stats := ChannelStats(records, "C1"); stats.Asked != 6 || stats.Skipped != 1 {
+		t.Errorf("got %+v for the channel; want 6 asked, 1 skipped", stats)
+	}
+}
+
+func TestCompletionTimes(t *testing.T) {
+	rec := standupOn("2026-10-19")
+	var stats ParticipationStats
+	for _, minutes := range []time.Duration{5, 10, 25} {
+		completed := rec.Started.Add(minutes * time.Minute)
+		p := participant("U1", participantAnswered)
+		p.Completed = &completed
+		stats.add(rec, p)
+	}
+
+	if avg := stats.AverageTimeToComplete(); avg != 40*time.Minute/3 {
+		t.Errorf("got an average of %s; want %s", avg, 40*time.Minute/3)
+	}
+	if within := stats.CompletedWithin(10 * time.Minute); within != 2.0/3 {
+		t.Errorf("got %f within 10 minutes; want two thirds", within)
+	}
+}
+
+func TestStreakFooter(t *testing.T) {
+	records := []StandupRecord{
+		standupOn("2026-10-15", participant("U1", participantAnswered), participant("U2", participantAnswered)),
+		standupOn("2026-10-16", participant("U1", participantAnswered), participant("U2", participantAbsent)),
+	}
+	today := standupOn("2026-10-19", participant("U1", participantAnswered), participant("U2", participantAnswered))
+
+	footer := StreakFooter(records, today, 3, builtinTemplates)
+	if want := ":fire: <@U1|u1> has answered 3 days in a row\n"; footer != want {
+		t.Errorf("got %q; want %q", footer, want)
+	}
+
+	templates, err := parseTemplates(map[string]string{templateStreak: "{{.User}}: {{.Days}}!"}, UserNagMessages, Questions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if footer := StreakFooter(records, today, 3, templates); footer != "<@U1|u1>: 3!\n" {
+		t.Errorf("got %q from the channel's template", footer)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+/* Everything we say about a stand-up, in the channel or to each person, is a
+ * text/template that a channel can override in its "templates", by these
+ * names, or a locale in its catalogue (see locales.go). Nags are a list of
+ * their own, "nags", which we go through in turn.
+ *
+ * DMs get the channel's name as .Channel. The summary gets .Channel,
+ * .Questions, .Final (false while it's still in progress), .Interrupted and
+ * .Sections, one for each person, rendered from the templates for what they
+ * did. Those get .User, a link to them, and for people who answered,
+ * .Answers, .Partial and, if the channel shows times, .Took, or for people
+ * who weren't asked, .Reason.
+ *
+ * The attachments layout has a heading, given what the summary is, and a
+ * footer, given .Interrupted and lists of people who didn't answer: .Absent,
+ * .Skipped, .Errors, .OnLeave, .Away and .Excluded. The partial note gets
+ * what an answered section does.
+ *
+ * The streak footer has a line for each person on a streak, given .User and
+ * .Days.
+ */
+const (
+	templateStart           = "start"
+	templateThanks          = "thanks"
+	templateSkipConfirmed   = "skip_confirmed"
+	templateTimeUp          = "time_up"
+	templateEndedEarly      = "ended_early"
+	templateCancelled       = "cancelled"
+	templateInterrupted     = "interrupted"
+	templateLeftChannel     = "left_channel"
+	templateAlreadyFinished = "already_finished"
+	templateNextStandup     = "next_standup"
+
+	templateSummary  = "summary"
+	templateAnswered = "answered"
+	templateAbsent   = "absent"
+	templateSkipped  = "skipped"
+	templateError    = "error"
+	templateOnLeave  = "on_leave"
+	templateAway     = "away"
+	templateExcluded = "excluded"
+
+	templateAttachmentsHeading = "attachments_heading"
+	templateAttachmentsPartial = "attachments_partial"
+	templateAttachmentsFooter  = "attachments_footer"
+
+	templateStreak = "streak"
+)
+
+var defaultTemplates = map[string]string{
+	templateStart:           UserStandupStartText,
+	templateThanks:          UserStandupEndText,
+	templateSkipConfirmed:   UserConfirmSkipText,
+	templateTimeUp:          UserStandupTimeUpText,
+	templateEndedEarly:      UserStandupEndedEarlyText,
+	templateCancelled:       UserStandupCancelledText,
+	templateInterrupted:     UserStandupInterruptedText,
+	templateLeftChannel:     UserLeftChannelText,
+	templateAlreadyFinished: UserStandupAlreadyFinishedText,
+	templateNextStandup:     UserNextStandupText,
+
+	templateSummary:  SummaryText,
+	templateAnswered: SummaryAnsweredText,
+	templateAbsent:   SummaryAbsentText,
+	templateSkipped:  SummarySkippedText,
+	templateError:    SummaryErrorText,
+	templateOnLeave:  SummaryOnLeaveText,
+	templateAway:     SummaryAwayText,
+	templateExcluded: SummaryExcludedText,
+
+	templateAttachmentsHeading: AttachmentsHeadingText,
+	templateAttachmentsPartial: AttachmentsPartialText,
+	templateAttachmentsFooter:  AttachmentsFooterText,
+
+	templateStreak: SummaryStreakText,
+}
+
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+type dmData struct {
+	Channel string
+}
+
+type summaryData struct {
+	Channel     string
+	Questions   []string
+	Final       bool
+	Interrupted bool
+	Sections    []string
+}
+
+type footerData struct {
+	Interrupted bool
+	Absent      []string
+	Skipped     []string
+	Errors      []string
+	OnLeave     []string
+	Away        []string
+	Excluded    []string
+}
+
+type streakData struct {
+	User string
+	Days int
+}
+
+type sectionData struct {
+	User        string
+	Answers     []string
+	Partial     bool
+	Took        string
+	Reason      string
+	Interrupted bool
+}
+
+// Templates are a channel's templates in one language, ready to render, and
+// the questions in that language.
+type Templates struct {
+	Questions []string
+	templates *template.Template
+	nags      int
+}
+
+var builtinTemplates, _ = parseTemplates(nil, UserNagMessages, Questions)
+
+// parseTemplates parses our templates, with any overrides, and the nags.
+func parseTemplates(overrides map[string]string, nags, questions []string) (*Templates, error) {
+	t := &Templates{Questions: questions, templates: template.New("").Funcs(templateFuncs), nags: len(nags)}
+	for name, text := range defaultTemplates {
+		if override, ok := overrides[name]; ok {
+			text = override
+		}
+		if _, err := t.templates.New(name).Parse(text); err != nil {
+			return nil, fmt.Errorf("template %s: %s", name, err)
+		}
+	}
+	for name := range overrides {
+		if _, ok := defaultTemplates[name]; !ok {
+			return nil, fmt.Errorf("there's no template called %s", name)
+		}
+	}
+	for i, text := range nags {
+		if _, err := t.templates.New(nagTemplateName(i)).Parse(text); err != nil {
+			return nil, fmt.Errorf("nag %d: %s", i+1, err)
+		}
+	}
+	return t, nil
+}
+
+func nagTemplateName(i int) string {
+	return "nag" + strconv.Itoa(i)
+}
+
+// Render renders a template, falling back on ours if the channel's fails.
+func (self *Templates) Render(name string, data interface{}) string {
+	out, err := self.execute(name, data)
+	if err != nil && self != builtinTemplates {
+		return builtinTemplates.Render(name, data)
+	}
+	return out
+}
+
+// Nag renders the nth nag, going round again once we run out.
+func (self *Templates) Nag(n int, data interface{}) string {
+	out, err := self.execute(nagTemplateName(n%self.nags), data)
+	if err != nil && self != builtinTemplates {
+		return builtinTemplates.Nag(n, data)
+	}
+	return out
+}
+
+func (self *Templates) execute(name string, data interface{}) (string, error) {
+	var out bytes.Buffer
+	if err := self.templates.ExecuteTemplate(&out, name, data); err != nil {
+		Log.Errorf("error rendering template %s: %s", name, err)
+		return "", err
+	}
+	return out.String(), nil
+}
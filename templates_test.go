@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTemplates(t *testing.T) {
+	tests := []struct {
+		overrides map[string]string
+		nags      []string
+	}{
+		{map[string]string{"thankyou": "Cheers!"}, nil},
+		{map[string]string{templateThanks: "{{.Cheers"}, nil},
+		{nil, []string{"Oi!", "{{end}}"}},
+	}
+	for _, test := range tests {
+		if _, err := parseTemplates(test.overrides, test.nags, Questions); err == nil {
+			t.Errorf("parsed %v and nags %q; want an error", test.overrides, test.nags)
+		}
+	}
+}
+
+func TestTemplatesRender(t *testing.T) {
+	templates, err := parseTemplates(map[string]string{
+		templateThanks:  "Cheers, #{{.Channel}}!",
+		templateSkipped: "{{.Nope}}",
+	}, []string{"First {{.Channel}}", "Second"}, Questions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := dmData{Channel: "design"}
+
+	tests := []struct {
+		name string
+		data interface{}
+		want string
+	}{
+		{templateThanks, data, "Cheers, #design!"},
+		{templateStart, data, "*WOOF!* Stand-up for #design starting.\nMessage me `skip` to duck out of this one."},
+		// it breaks, so it's ours
+		{templateSkipped, sectionData{User: "<@U1>"}, "<@U1> skipped this stand-up.\n"},
+	}
+	for _, test := range tests {
+		if got := templates.Render(test.name, test.data); got != test.want {
+			t.Errorf("%s: got %q; want %q", test.name, got, test.want)
+		}
+	}
+
+	// round and round
+	for n, want := range []string{"First design", "Second", "First design"} {
+		if got := templates.Nag(n, data); got != want {
+			t.Errorf("nag %d: got %q; want %q", n, got, want)
+		}
+	}
+}
+
+func TestSummaryTemplates(t *testing.T) {
+	data := summaryData{Channel: "design", Questions: Questions[:1], Sections: []string{"<@U1> is away.\n"}}
+	tests := []struct {
+		final, interrupted bool
+		prefix             string
+	}{
+		{false, false, "*Stand-up in progress!*"},
+		{true, false, "<!here>: *BARKBARKBARK Stand-up done!*"},
+		{true, true, "<!here>: *Stand-up interrupted!*"},
+	}
+	for _, test := range tests {
+		data.Final, data.Interrupted = test.final, test.interrupted
+		got := builtinTemplates.Render(templateSummary, data)
+		if !strings.HasPrefix(got, test.prefix) || !strings.Contains(got, "• "+Questions[0]+"\n") ||
+			!strings.HasSuffix(got, "<@U1> is away.\n") {
+			t.Errorf("final %t, interrupted %t: got %q", test.final, test.interrupted, got)
+		}
+	}
+
+	footer := builtinTemplates.Render(templateAttachmentsFooter, footerData{Absent: []string{"<@U1>", "<@U2>"}, Away: []string{"<@U3>"}})
+	if footer != "Never replied: <@U1>, <@U2>. Away: <@U3>. " {
+		t.Errorf("got footer %q", footer)
+	}
+}
+
+func TestChannelTemplates(t *testing.T) {
+	config := &Config{}
+	cc := ChannelConfig{Locale: "en", Templates: map[string]string{templateThanks: "Cheers!"}, Nags: []string{"Oi!"}}
+
+	templates, err := config.Templates(cc, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := templates.Render(templateThanks, dmData{}); got != "Cheers!" {
+		t.Errorf("got %q; want the channel's", got)
+	}
+	if got := templates.Nag(1, dmData{}); got != "Oi!" {
+		t.Errorf("got nag %q; want the channel's", got)
+	}
+
+	// the channel's are in English, so they're not for people asked in German
+	if templates, err = config.Templates(cc, "de"); err != nil {
+		t.Fatal(err)
+	}
+	if got := templates.Render(templateThanks, dmData{}); got != builtinCatalogues["de"].Templates[templateThanks] {
+		t.Errorf("got %q; want ours, in German", got)
+	}
+	if templates.Questions[0] != builtinCatalogues["de"].Questions[0] {
+		t.Errorf("got questions %q; want them in German", templates.Questions)
+	}
+}
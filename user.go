@@ -3,7 +3,9 @@ package main
 import (
 	"fmt"
 	"github.com/abourget/slack"
+	"math/rand"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -14,20 +16,47 @@ import (
  */
 
 const userSkipCommand = "skip"
+const userStatsCommand = "stats"
+
+// While we're asking someone questions, everything they say is an answer,
+// bar skip and snooze, unless it starts with this.
+const userCommandPrefix = "!"
+
+// How hard we try to ask someone a question.
+const questionAttempts = 3
+
+var questionRetryDelay = 2 * time.Second
+
+// Slack's clock and ours may not quite agree on when we asked.
+const questionClockSkew = 5 * time.Second
+
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+const (
+	slackPresenceActive = "active"
+	slackPresenceAway   = "away"
+)
 
 type User struct {
-	Info               slack.User
+	info               slack.User
+	infoMutex          sync.RWMutex
 	client             *AuthedSlack
+	logger             *Logger
+	manager            *UserManager
 	imChannelId        string
 	events             chan userEvent
 	standupQueue       []*Standup
+	scheduledStandups  map[*Standup]*time.Timer
+	heldStandups       []*Standup
 	currentStandup     *Standup
 	currentQuestionIdx int
 	standupsFinished   map[*Standup]bool
-	nagMinuteDelays    []int
-	nagMessages        []string
 	nagMessageIdx      int
-	nagTimers          map[*time.Timer]bool
+	nagTimer           *time.Timer
+	nagsSent           int
+	snoozedUntil       time.Time
+	lastTyped          time.Time
+	lastAnswered       time.Time
 }
 
 type userEvent interface {
@@ -35,7 +64,10 @@ type userEvent interface {
 }
 
 type userMessage slack.MessageEvent
-type userNag struct{}
+type userNag struct {
+	standup *Standup
+}
+type userTyping struct{}
 
 // tried to alias to the pointer type instead of wrapping in a struct, but
 // go kept moaning at me and I couldn't work out why.
@@ -43,75 +75,166 @@ type userStartStandup struct {
 	standup *Standup
 }
 
+type userBeginStandup struct {
+	standup *Standup
+}
+
 type userStandupTimeUp struct {
 	standup *Standup
+	reason  finishReason
+}
+
+type userPresenceChange struct {
+	presence string
 }
 
 type userEndStandup struct {
 	standup *Standup
 }
 
+type userSkipStandup struct {
+	standup *Standup
+	// whether they were skipped, or had nothing to skip
+	reply chan bool
+}
+
+type userLeftStandup struct {
+	standup *Standup
+}
+
+// we couldn't ask them a question, so they can't carry on
+type userQuestionFailed struct {
+	standup *Standup
+}
+
 func (um userMessage) isUserEvent() {
 }
 
 func (un userNag) isUserEvent() {
 }
 
+func (ut userTyping) isUserEvent() {
+}
+
 func (s userStartStandup) isUserEvent() {
 }
 
 func (s userEndStandup) isUserEvent() {
 }
 
+func (s userBeginStandup) isUserEvent() {
+}
+
 func (s userStandupTimeUp) isUserEvent() {
 }
 
+func (s userSkipStandup) isUserEvent() {
+}
+
+func (s userLeftStandup) isUserEvent() {
+}
+
+func (p userPresenceChange) isUserEvent() {
+}
+
+func (f userQuestionFailed) isUserEvent() {
+}
+
 func normaliseCommand(cmd string) string {
 	return strings.ToLower(strings.TrimSpace(cmd))
 }
 
-func NewUser(client *AuthedSlack, info slack.User, imChannelId string) (u *User) {
+// commandText takes the prefix off a command, if it has one.
+func commandText(text string) (cmd string, prefixed bool) {
+	cmd = strings.TrimSpace(text)
+	if strings.HasPrefix(cmd, userCommandPrefix) {
+		return strings.TrimPrefix(cmd, userCommandPrefix), true
+	}
+	return cmd, false
+}
+
+func NewUser(manager *UserManager, info slack.User, imChannelId string) (u *User) {
 	u = &User{
-		Info:             info,
-		client:           client,
-		imChannelId:      imChannelId,
-		events:           make(chan userEvent),
-		standupQueue:     make([]*Standup, 0, 5),
-		standupsFinished: make(map[*Standup]bool),
-		nagMessages:      RandomisedNags(),
-		nagMinuteDelays:  StandupNagMinuteDelays,
+		info:              info,
+		client:            manager.client,
+		logger:            Log.With("user_id", info.Id),
+		manager:           manager,
+		imChannelId:       imChannelId,
+		events:            make(chan userEvent),
+		standupQueue:      make([]*Standup, 0, 5),
+		scheduledStandups: make(map[*Standup]*time.Timer),
+		standupsFinished:  make(map[*Standup]bool),
+		nagMessageIdx:     rand.Intn(len(UserNagMessages)),
 	}
-	u.resetNags()
 	go u.start()
 	return
 }
 
+// Info is what Slack last told us about them. Stand-ups read it from their
+// own goroutines, while UserManager keeps it up to date.
+func (self *User) Info() slack.User {
+	self.infoMutex.RLock()
+	defer self.infoMutex.RUnlock()
+	return self.info
+}
+
+func (self *User) setInfo(info slack.User) {
+	self.infoMutex.Lock()
+	defer self.infoMutex.Unlock()
+	self.info = info
+}
+
 func (self *User) start() {
-	for _, m := range self.nagMinuteDelays {
-		nag := time.AfterFunc(time.Duration(m)*time.Minute, self.nag)
-		self.nagTimers[nag] = true
-	}
+	metricUserGoroutines.Inc("")
+	defer metricUserGoroutines.Add("", -1)
 
 	for ei := range self.events {
 		switch e := ei.(type) {
 		case userMessage:
-			if self.currentStandup != nil {
-				if self.handleStandupCommand(e.Text) {
+			wasAsking := self.currentStandup != nil
+			// they're clearly around, whatever Slack says, so they can skip
+			// what we'd held for them; but it's not an answer to a question
+			// they hadn't seen
+			self.releaseHeldStandups()
+			asking := self.currentStandup != nil
+			if cmd, prefixed := commandText(e.Text); (prefixed || !wasAsking) && self.handleCommand(cmd) {
+				continue
+			}
+			if asking {
+				if self.handleStandupCommand(e.Text) || !wasAsking {
 					continue
 				}
-				DebugLog.Printf("reporting message id %s as answer from %s", e.Id, self.Info.Id)
-				self.currentStandup.ReportUserAnswer(self, self.currentQuestionIdx, e.Text)
+				self.standupLogger().Debugf("reporting message %s as answer", e.Timestamp)
+				self.currentStandup.ReportUserAnswer(self, self.currentQuestionIdx, e.Text, e.Timestamp)
+				self.lastAnswered = time.Now()
 				self.advanceQuestion()
 			}
 
 		case userStartStandup:
 			s := e.standup
-			s.ReportUserAcknowledged(self)
+			if !s.ReportUserAcknowledged(self) {
+				continue
+			}
 
-			if self.currentStandup == nil {
-				self.startStandup(s)
+			if wait := s.StartTimeFor(self).Sub(time.Now()); wait > 0 {
+				s.userLogger(self).Infof("asking in %s", wait)
+				self.scheduledStandups[s] = time.AfterFunc(wait, func() {
+					self.events <- userBeginStandup{standup: s}
+				})
 			} else {
-				self.standupQueue = append(self.standupQueue, s)
+				self.beginStandupWhenActive(s)
+			}
+
+		case userBeginStandup:
+			s := e.standup
+			if _, ok := self.scheduledStandups[s]; ok {
+				delete(self.scheduledStandups, s)
+				self.beginStandupWhenActive(s)
+			}
+
+		case userPresenceChange:
+			if e.presence == slackPresenceActive {
+				self.releaseHeldStandups()
 			}
 
 		case userEndStandup:
@@ -121,28 +244,70 @@ func (self *User) start() {
 
 			if s == self.currentStandup {
 				self.currentStandup = nil
-				self.resetNags()
+				self.stopNag()
 
 				next := self.popQueuedStandup()
 				if next != nil {
 					if self.standupsFinished[next] {
 						self.standupAlreadyFinished(next)
 					} else {
-						self.sendIM(UserNextStandupText)
+						self.sendIM(next.Text(self.locale(), templateNextStandup))
 						self.startStandup(next)
 					}
 				}
 			}
 
+		case userSkipStandup:
+			s := e.standup
+			skipped := true
+			if s == self.currentStandup {
+				self.skipCurrentStandup()
+			} else if self.unscheduleStandup(s) || self.removeHeldStandup(s) || self.removeQueuedStandup(s) {
+				s.ReportUserSkip(self)
+			} else {
+				// we never asked them, or they're done with it
+				skipped = false
+			}
+			e.reply <- skipped
+
+		case userLeftStandup:
+			s := e.standup
+			self.unscheduleStandup(s)
+			self.removeHeldStandup(s)
+			self.removeQueuedStandup(s)
+			if s == self.currentStandup {
+				self.sendIM(s.Text(self.locale(), templateLeftChannel))
+				self.endStandup(s)
+			}
+
+		case userQuestionFailed:
+			if e.standup == self.currentStandup {
+				self.handleError()
+			}
+
 		case userNag:
-			self.sendIM(self.nagMessages[self.nagMessageIdx])
-			self.nagMessageIdx = (self.nagMessageIdx + 1) % len(self.nagMessages)
+			self.handleNag(e.standup)
+
+		case userTyping:
+			self.lastTyped = time.Now()
 
 		case userStandupTimeUp:
 			s := e.standup
+			self.unscheduleStandup(s)
+			self.removeHeldStandup(s)
 			if s == self.currentStandup {
-				self.sendIM(UserStandupTimeUpText)
+				switch e.reason {
+				case finishCancelled:
+					self.sendIM(s.Text(self.locale(), templateCancelled))
+				case finishEndedEarly:
+					self.sendIM(s.Text(self.locale(), templateEndedEarly))
+				case finishInterrupted:
+					self.sendIM(s.Text(self.locale(), templateInterrupted))
+				default:
+					self.sendIM(s.Text(self.locale(), templateTimeUp))
+				}
 			}
+			s.ReportUserTold(self)
 			self.endStandup(s)
 		}
 	}
@@ -152,43 +317,209 @@ func (self *User) StartStandup(s *Standup) {
 	self.events <- userStartStandup{standup: s}
 }
 
+// SkipStandup skips them out of a stand-up, returning false if they weren't
+// in it, or had already finished.
+func (self *User) SkipStandup(s *Standup) bool {
+	reply := make(chan bool, 1)
+	self.events <- userSkipStandup{standup: s, reply: reply}
+	return <-reply
+}
+
 func (self *User) ReceiveMessageReply(m slack.MessageEvent) {
 	self.events <- userMessage(m)
 }
 
-func (self *User) StandupTimeUp(s *Standup) {
-	self.events <- userStandupTimeUp{standup: s}
+func (self *User) PresenceChanged(presence string) {
+	self.events <- userPresenceChange{presence: presence}
 }
 
+func (self *User) Typing() {
+	self.events <- userTyping{}
+}
+
+func (self *User) LeftStandup(s *Standup) {
+	self.events <- userLeftStandup{standup: s}
+}
+
+func (self *User) StandupTimeUp(s *Standup, reason finishReason) {
+	self.events <- userStandupTimeUp{standup: s, reason: reason}
+}
+
+/* sendIM is for the user's own goroutine, so it can say which stand-up a
+ * failure was in. It's only worth trying once: anything but a question is
+ * just to let them know, so they can carry on without it.
+ */
 func (self *User) sendIM(text string) {
+	self.postIM(self.standupLogger(), text)
+}
+
+// tell answers a command, from any goroutine. Commands aren't about a
+// stand-up, even if they come in one.
+func (self *User) tell(text string) {
+	self.postIM(self.logger, text)
+}
+
+// postIM is safe from any goroutine; it logs failures to logger.
+func (self *User) postIM(logger *Logger, text string) error {
 	_, _, err := self.client.PostMessage(self.imChannelId, text, DefaultMessageParameters)
 	if err != nil {
-		self.handleError()
+		logger.Errorf("error sending message: %s", err)
+	}
+	return err
+}
+
+/* askQuestion runs in a goroutine of its own. Someone can't answer a
+ * question they never got, so if Slack fails posting one we try again, but
+ * not before checking it didn't get through after all. If it never does,
+ * their stand-up's over.
+ */
+func (self *User) askQuestion(s *Standup, logger *Logger, question string) {
+	since := time.Now().Add(-questionClockSkew)
+	for attempt := 1; ; attempt++ {
+		err := self.postIM(logger, question)
+		if err == nil {
+			return
+		}
+		if attempt >= questionAttempts {
+			break
+		}
+		time.Sleep(time.Duration(attempt) * questionRetryDelay)
+		if sent, err := self.sentSince(since, question); err != nil {
+			// better they miss it than get it twice
+			logger.Errorf("error checking whether the question was sent: %s", err)
+			break
+		} else if sent {
+			logger.Infof("the question got through after all")
+			return
+		}
+	}
+	self.events <- userQuestionFailed{standup: s}
+}
+
+// sentSince says whether we've posted text to them since a time.
+func (self *User) sentSince(since time.Time, text string) (bool, error) {
+	params := slack.NewHistoryParameters()
+	params.Oldest = fmt.Sprintf("%d.000000", since.Unix())
+	history, err := self.client.GetIMHistory(self.imChannelId, params)
+	if err != nil {
+		return false, err
+	}
+	// the library escapes what we post, so Slack has it escaped
+	text = slackEscaper.Replace(text)
+	for _, m := range history.Messages {
+		if m.UserId == self.client.UserId && m.Text == text {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (self *User) handleCommand(text string) bool {
+	switch normaliseCommand(text) {
+	case userStatsCommand:
+		go self.sendStats()
+		return true
+	}
+	return self.handlePreferenceCommand(text) || self.handleAdminCommand(text)
+}
+
+func (self *User) sendStats() {
+	if self.manager.history == nil {
+		self.tell(self.replyText(replyNoStats, nil))
+		return
+	}
+	records, err := self.manager.history.Load()
+	if err != nil {
+		self.logger.Errorf("error loading history for stats: %s", err)
+		return
 	}
+	self.tell(UserStats(records, self.Info().Id).Describe(self.replies()))
 }
 
 func (self *User) handleStandupCommand(cmd string) bool {
 	cmd = normaliseCommand(cmd)
 	switch cmd {
 	case userSkipCommand:
-		self.currentStandup.ReportUserSkip(self)
-		self.sendIM(UserConfirmSkipText)
-		self.endCurrentStandup()
+		self.skipCurrentStandup()
 		return true
 	}
-	return false
+	return self.handleSnoozeCommand(cmd)
+}
+
+func (self *User) skipCurrentStandup() {
+	self.currentStandup.ReportUserSkip(self)
+	self.sendIM(self.currentStandup.Text(self.locale(), templateSkipConfirmed))
+	self.endCurrentStandup()
 }
 
 func (self *User) advanceQuestion() {
 	if self.currentStandup.IsLastQuestion(self.currentQuestionIdx) {
-		self.sendIM(UserStandupEndText)
+		self.sendIM(self.currentStandup.Text(self.locale(), templateThanks))
 		self.endCurrentStandup()
 	} else {
 		self.currentQuestionIdx++
-		go self.askCurrentQuestion()
+		go self.askQuestion(self.currentStandup, self.standupLogger(), self.currentQuestion())
+	}
+}
+
+func (self *User) beginStandup(s *Standup) {
+	if self.currentStandup == nil {
+		self.startStandup(s)
+	} else {
+		self.standupQueue = append(self.standupQueue, s)
 	}
 }
 
+/* In channels that wait for presence, we don't ask anyone who's away,
+ * or start nagging them, until Slack tells us they're back or they message
+ * us. The stand-up's deadline still applies, so they may never be asked.
+ */
+func (self *User) beginStandupWhenActive(s *Standup) {
+	if s.config.WaitForPresence && !self.isActive(s) {
+		s.userLogger(self).Infof("away; holding the stand-up until they're back")
+		self.heldStandups = append(self.heldStandups, s)
+		return
+	}
+	self.beginStandup(s)
+}
+
+func (self *User) isActive(s *Standup) bool {
+	presence, err := self.client.GetUserPresence(self.Info().Id)
+	if err != nil {
+		// better to ask them than to hold on forever
+		s.userLogger(self).Errorf("error getting presence: %s", err)
+		return true
+	}
+	return presence.Presence != slackPresenceAway
+}
+
+func (self *User) releaseHeldStandups() {
+	held := self.heldStandups
+	self.heldStandups = nil
+	for _, s := range held {
+		self.beginStandup(s)
+	}
+}
+
+func (self *User) removeHeldStandup(s *Standup) bool {
+	for i, held := range self.heldStandups {
+		if held == s {
+			self.heldStandups = append(self.heldStandups[:i], self.heldStandups[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (self *User) unscheduleStandup(s *Standup) bool {
+	timer, ok := self.scheduledStandups[s]
+	if ok {
+		timer.Stop()
+		delete(self.scheduledStandups, s)
+	}
+	return ok
+}
+
 func (self *User) startStandup(s *Standup) {
 	if s.Finished {
 		self.standupAlreadyFinished(s)
@@ -198,10 +529,16 @@ func (self *User) startStandup(s *Standup) {
 	self.currentStandup = s
 	self.currentQuestionIdx = 0
 
+	self.nagsSent = 0
+	self.snoozedUntil = time.Time{}
+	self.scheduleNag()
+
+	// worked out here, since answers can move us on before they're sent
+	start, question := s.Text(self.locale(), templateStart), self.currentQuestion()
+	logger := self.standupLogger()
 	go func() {
-		self.sendIM(fmt.Sprintf(UserStandupStartText,
-			self.currentStandup.Channel.Name))
-		self.askCurrentQuestion()
+		self.postIM(logger, start)
+		self.askQuestion(s, logger, question)
 	}()
 }
 
@@ -224,29 +561,61 @@ func (self *User) popQueuedStandup() (s *Standup) {
 	return
 }
 
+func (self *User) removeQueuedStandup(s *Standup) bool {
+	for i, queued := range self.standupQueue {
+		if queued == s {
+			self.standupQueue = append(self.standupQueue[:i], self.standupQueue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
 func (self *User) standupAlreadyFinished(s *Standup) {
-	self.sendIM(fmt.Sprintf(
-		UserStandupAlreadyFinishedText, s.Channel.Name))
+	self.sendIM(s.Text(self.locale(), templateAlreadyFinished))
 	if self.standupsFinished[s] {
 		delete(self.standupsFinished, s)
 	}
 }
 
-func (self *User) nag() {
-	self.events <- userNag{}
+func (self *User) currentQuestion() string {
+	return self.currentStandup.Question(self.locale(), self.currentQuestionIdx)
 }
 
-func (self *User) resetNags() {
-	if self.nagTimers != nil {
-		for nag, _ := range self.nagTimers {
-			nag.Stop()
-		}
+// locale is the language someone's chosen to be asked in, or "" for each
+// channel's own.
+func (self *User) locale() string {
+	if self.manager.preferences == nil {
+		return ""
 	}
-	self.nagTimers = make(map[*time.Timer]bool)
+	return self.manager.preferences.Get(self.Info().Id).Locale
 }
 
-func (self *User) askCurrentQuestion() {
-	self.sendIM(self.currentStandup.Questions[self.currentQuestionIdx])
+// replies are in the language they've chosen, or otherwise the defaults'.
+func (self *User) replies() *Replies {
+	locale := self.locale()
+	if locale == "" {
+		locale = Settings.DefaultLocale()
+	}
+	replies, err := Settings.Replies(locale)
+	if err != nil {
+		// they chose it before the config changed
+		self.logger.With("locale", locale).Errorf("error using locale; replying in English: %s", err)
+		return builtinReplies
+	}
+	return replies
+}
+
+func (self *User) replyText(name string, data interface{}) string {
+	return self.replies().Render(name, data)
+}
+
+// Only for the user's own goroutine, which owns the current stand-up.
+func (self *User) standupLogger() *Logger {
+	if self.currentStandup == nil {
+		return self.logger
+	}
+	return self.currentStandup.userLogger(self).With("question_idx", self.currentQuestionIdx)
 }
 
 func (self *User) handleError() {
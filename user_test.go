@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/abourget/slack"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAnswersThatLookLikeCommandsAreAnswers(t *testing.T) {
+	b := newTestBot(t, slack.User{Id: "U1", Name: "bob"})
+	defer b.Close()
+
+	s := b.start(t, testChannel("C1", "design", "U1"), "U1")
+	for i, answer := range []string{"stats", "resume", "preferences"} {
+		b.say("U1", answer)
+		b.slack.waitForDM(t, "U1", Questions[i+1])
+	}
+	b.say("U1", "!stats")
+	b.slack.waitForDM(t, "U1", UserNoStatsText)
+	b.say("U1", "opt in")
+	b.slack.waitForDM(t, "U1", UserStandupEndText)
+	b.waitReported(t)
+
+	records, err := b.history.Load()
+	if err != nil || len(records) != 1 {
+		t.Fatalf("got %v, %v; want one stand-up", records, err)
+	}
+	want := []string{"stats", "resume", "preferences", "opt in"}
+	if got := records[0].Participants[0].Answers; !equalStrings(got, want) {
+		t.Errorf("got answers %q; want %q", got, want)
+	}
+	if s.finishReason != finishAllAnswered {
+		t.Errorf("finished because %s; want %s", s.finishReason, finishAllAnswered)
+	}
+}
+
+func TestCommandsWhenNotBeingAsked(t *testing.T) {
+	b := newTestBot(t, slack.User{Id: "U1", Name: "bob"})
+	defer b.Close()
+
+	b.say("U1", "stats")
+	b.slack.waitForDM(t, "U1", UserNoStatsText)
+	b.say("U1", "!preferences")
+	b.slack.waitForDM(t, "U1", UserNoPreferencesText)
+}
+
+func TestCommandText(t *testing.T) {
+	tests := []struct {
+		text     string
+		cmd      string
+		prefixed bool
+	}{
+		{"stats", "stats", false},
+		{" !stats ", "stats", true},
+		{"!end #design", "end #design", true},
+		{"wow!", "wow!", false},
+	}
+	for _, test := range tests {
+		cmd, prefixed := commandText(test.text)
+		if cmd != test.cmd || prefixed != test.prefixed {
+			t.Errorf("commandText(%q) = %q, %t; want %q, %t", test.text, cmd, prefixed, test.cmd, test.prefixed)
+		}
+	}
+}
+
+func TestMessagesThatFailDontEndTheStandup(t *testing.T) {
+	b := newTestBot(t, slack.User{Id: "U1", Name: "bob"})
+	defer b.Close()
+
+	// the start message
+	b.slack.failNext("chat.postMessage", http.StatusInternalServerError)
+	s := b.start(t, testChannel("C1", "design", "U1"), "U1")
+
+	b.slack.failNext("chat.postMessage", http.StatusInternalServerError)
+	b.say("U1", "!stats")
+	waitFor(t, "stats to fail", func() bool { return b.slack.Calls("chat.postMessage") == 3 })
+
+	b.say("U1", "yesterday")
+	b.slack.waitForDM(t, "U1", Questions[1])
+	if s.Finished {
+		t.Error("finished after a message failed")
+	}
+}
+
+func TestQuestionsAreRetried(t *testing.T) {
+	defer func(d time.Duration) { questionRetryDelay = d }(questionRetryDelay)
+	questionRetryDelay = 10 * time.Millisecond
+
+	b := newTestBot(t, slack.User{Id: "U1", Name: "bob"})
+	defer b.Close()
+	b.start(t, testChannel("C1", "design", "U1"), "U1")
+
+	// it never got there
+	b.slack.failNext("chat.postMessage", http.StatusInternalServerError)
+	b.say("U1", "yesterday")
+	b.slack.waitForDM(t, "U1", Questions[1])
+
+	// it did really
+	b.slack.failAfter("chat.postMessage", http.StatusServiceUnavailable)
+	b.say("U1", "today")
+	b.slack.waitForDM(t, "U1", Questions[2])
+	waitFor(t, "the DM to be checked", func() bool { return b.slack.Calls("im.history") == 2 })
+
+	dms := b.slack.DMs("U1")
+	for _, q := range Questions[1:3] {
+		if n := countOf(dms, q); n != 1 {
+			t.Errorf("asked %q %d times; want once", q, n)
+		}
+	}
+}
+
+func TestQuestionThatNeverGetsThroughEndsTheStandup(t *testing.T) {
+	defer func(d time.Duration) { questionRetryDelay = d }(questionRetryDelay)
+	questionRetryDelay = 10 * time.Millisecond
+
+	b := newTestBot(t, slack.User{Id: "U1", Name: "bob"}, slack.User{Id: "U2", Name: "amy"})
+	defer b.Close()
+	s := b.start(t, testChannel("C1", "design", "U1", "U2"), "U1", "U2")
+
+	statuses := make([]int, questionAttempts)
+	for i := range statuses {
+		statuses[i] = http.StatusInternalServerError
+	}
+	b.slack.failNext("chat.postMessage", statuses...)
+	b.say("U1", "yesterday")
+	waitFor(t, "bob's stand-up to end", func() bool {
+		for _, p := range s.record().Participants {
+			if p.UserId == "U1" && p.Status == participantError {
+				return true
+			}
+		}
+		return false
+	})
+
+	s.End()
+	b.waitReported(t)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestHeldUntilActive(t *testing.T) {
+	defer func(settings *Config) { Settings = settings }(Settings)
+	Settings = &Config{Defaults: json.RawMessage(`{"wait_for_presence": true}`)}
+
+	b := newTestBot(t,
+		slack.User{Id: "U1", Name: "bob"},
+		slack.User{Id: "U2", Name: "amy"},
+		slack.User{Id: "U3", Name: "cat"},
+		slack.User{Id: "U4", Name: "dan"})
+	defer b.Close()
+	for _, userId := range []string{"U1", "U2", "U4"} {
+		b.slack.setAway(userId, true)
+	}
+
+	s := b.start(t, testChannel("C1", "design", "U1", "U2", "U3", "U4"), "U3")
+	waitFor(t, "everyone to be held", func() bool {
+		return asked(s, "U1") != nil && asked(s, "U2") != nil && asked(s, "U4") != nil
+	})
+	for _, userId := range []string{"U1", "U2", "U4"} {
+		if dms := b.slack.DMs(userId); len(dms) > 0 {
+			t.Errorf("%s was asked while away: %q", userId, dms)
+		}
+	}
+
+	b.users.ReceivePresenceChange(slack.PresenceChangeEvent{UserId: "U1", Presence: slackPresenceActive})
+	b.slack.waitForDM(t, "U1", Questions[0])
+	// what brings them back can skip it
+	b.say("U2", "skip")
+	b.slack.waitForDM(t, "U2", UserConfirmSkipText)
+	// but isn't an answer
+	b.say("U4", "morning!")
+	b.slack.waitForDM(t, "U4", Questions[0])
+	for _, userId := range []string{"U1", "U3", "U4"} {
+		answerAll(b, userId)
+	}
+	b.waitReported(t)
+
+	statuses := make(map[string]string)
+	for _, p := range s.record().Participants {
+		statuses[p.UserId] = p.Status
+		if p.UserId == "U4" && p.Answers[0] != Questions[0] {
+			t.Errorf("dan answered %q; want what he said after being asked", p.Answers)
+		}
+	}
+	want := map[string]string{"U1": participantAnswered, "U2": participantSkipped, "U3": participantAnswered, "U4": participantAnswered}
+	for userId, status := range want {
+		if statuses[userId] != status {
+			t.Errorf("%s was %q; want %q", userId, statuses[userId], status)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"github.com/abourget/slack"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Slack doesn't tell us when user groups change, so we look again after this.
+const userGroupsMaxAge = 10 * time.Minute
+
+/* UserDirectory knows everyone in the workspace: their names, timezones and
+ * whether they're deleted or bots. It starts with the list Slack gives us when
+ * we connect to RTM, or one users.list call if we need it before then, and is
+ * kept up to date as people join or change their profiles. Anyone we still
+ * haven't heard of, we ask Slack about.
+ */
+type UserDirectory struct {
+	client    userSource
+	mutex     sync.RWMutex
+	users     map[string]slack.User
+	loaded    bool
+	loadMutex sync.Mutex
+
+	groupsMutex  sync.Mutex
+	groups       []userGroup
+	groupsLoaded time.Time
+}
+
+// userSource is the part of the Slack client the directory uses, so that it
+// can be faked when testing without Slack.
+type userSource interface {
+	GetUserInfo(userId string) (*slack.User, error)
+	GetUsers() ([]slack.User, error)
+	GetUserGroups() ([]userGroup, error)
+}
+
+func NewUserDirectory(client userSource) *UserDirectory {
+	return &UserDirectory{
+		client: client,
+		users:  make(map[string]slack.User),
+	}
+}
+
+// Reset replaces everyone we know with a fresh list from Slack.
+func (self *UserDirectory) Reset(users []slack.User) {
+	byId := make(map[string]slack.User, len(users))
+	for _, u := range users {
+		byId[u.Id] = u
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.users = byId
+	self.loaded = true
+}
+
+func (self *UserDirectory) Update(user slack.User) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.users[user.Id] = user
+}
+
+func (self *UserDirectory) Get(userId string) (*slack.User, error) {
+	if user, ok := self.lookup(userId); ok {
+		return &user, nil
+	}
+	if self.load() {
+		if user, ok := self.lookup(userId); ok {
+			return &user, nil
+		}
+	}
+
+	user, err := self.client.GetUserInfo(userId)
+	if err != nil {
+		return nil, err
+	}
+	self.Update(*user)
+	return user, nil
+}
+
+func (self *UserDirectory) lookup(userId string) (user slack.User, ok bool) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+	user, ok = self.users[userId]
+	return
+}
+
+/* Resolve turns a list of user ids or names, or user groups by id or handle,
+ * into everyone they mean, once each and in order.
+ */
+func (self *UserDirectory) Resolve(refs []string) []string {
+	userIds := make([]string, 0, len(refs))
+	seen := make(map[string]bool)
+	add := func(userId string) {
+		if !seen[userId] {
+			seen[userId] = true
+			userIds = append(userIds, userId)
+		}
+	}
+
+	for _, ref := range refs {
+		ref = strings.TrimPrefix(ref, "@")
+		if user, ok := self.find(ref); ok {
+			add(user.Id)
+			continue
+		}
+		found := false
+		for _, g := range self.UserGroups() {
+			if g.Id == ref || g.Handle == ref {
+				for _, userId := range g.Users {
+					add(userId)
+				}
+				found = true
+			}
+		}
+		if !found {
+			Log.Warnf("there's nobody and no user group called %s", ref)
+		}
+	}
+	return userIds
+}
+
+// find looks for someone by id or name among everyone we know.
+func (self *UserDirectory) find(ref string) (user slack.User, ok bool) {
+	if user, ok = self.lookup(ref); ok || !self.load() {
+		return
+	}
+	if user, ok = self.lookup(ref); ok {
+		return
+	}
+
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+	for _, user = range self.users {
+		if user.Name == ref {
+			return user, true
+		}
+	}
+	return user, false
+}
+
+// UserGroups returns the workspace's user groups and who's in them.
+func (self *UserDirectory) UserGroups() []userGroup {
+	self.groupsMutex.Lock()
+	defer self.groupsMutex.Unlock()
+
+	if time.Since(self.groupsLoaded) < userGroupsMaxAge {
+		return self.groups
+	}
+	groups, err := self.client.GetUserGroups()
+	if err != nil {
+		// most likely we haven't been given the usergroups:read scope
+		Log.Errorf("error listing user groups; ignoring them: %s", err)
+	} else {
+		self.groups = groups
+	}
+	// either way, don't ask again for a while
+	self.groupsLoaded = time.Now()
+	return self.groups
+}
+
+// load fetches everyone, unless we have already, saying whether we have.
+func (self *UserDirectory) load() bool {
+	// everyone else can wait for the one of us that's fetching
+	self.loadMutex.Lock()
+	defer self.loadMutex.Unlock()
+
+	self.mutex.RLock()
+	loaded := self.loaded
+	self.mutex.RUnlock()
+	if loaded {
+		return true
+	}
+
+	users, err := self.client.GetUsers()
+	if err != nil {
+		Log.Errorf("error listing users; asking about them one at a time: %s", err)
+		return false
+	}
+	self.Reset(users)
+	return true
+}
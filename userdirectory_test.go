@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"github.com/abourget/slack"
+	"testing"
+	"time"
+)
+
+// fakeUserSource is a workspace, without Slack.
+type fakeUserSource struct {
+	users     []slack.User
+	groups    []userGroup
+	listErr   error
+	groupsErr error
+	calls     map[string]int
+}
+
+func newFakeUserSource(users ...slack.User) *fakeUserSource {
+	return &fakeUserSource{users: users, calls: make(map[string]int)}
+}
+
+func (self *fakeUserSource) GetUserInfo(userId string) (*slack.User, error) {
+	self.calls["users.info"]++
+	for _, u := range self.users {
+		if u.Id == userId {
+			return &u, nil
+		}
+	}
+	return nil, errors.New("user_not_found")
+}
+
+func (self *fakeUserSource) GetUsers() ([]slack.User, error) {
+	self.calls["users.list"]++
+	return self.users, self.listErr
+}
+
+func (self *fakeUserSource) GetUserGroups() ([]userGroup, error) {
+	self.calls["usergroups.list"]++
+	return self.groups, self.groupsErr
+}
+
+func TestUserDirectoryGet(t *testing.T) {
+	source := newFakeUserSource(slack.User{Id: "U1", Name: "bob"})
+	directory := NewUserDirectory(source)
+
+	for i := 0; i < 2; i++ {
+		if u, err := directory.Get("U1"); err != nil || u.Name != "bob" {
+			t.Fatalf("got %v, %v; want bob", u, err)
+		}
+	}
+	if _, err := directory.Get("U2"); err == nil {
+		t.Error("found someone who isn't there")
+	}
+	// everyone at once, then only who we hadn't heard of
+	if source.calls["users.list"] != 1 || source.calls["users.info"] != 1 {
+		t.Errorf("made calls %v; want one list and one lookup", source.calls)
+	}
+
+	directory.Update(slack.User{Id: "U1", Name: "robert"})
+	if u, _ := directory.Get("U1"); u.Name != "robert" {
+		t.Errorf("got %s after they changed their name; want robert", u.Name)
+	}
+}
+
+func TestUserDirectoryGetWithoutList(t *testing.T) {
+	source := newFakeUserSource(slack.User{Id: "U1", Name: "bob"})
+	source.listErr = errors.New("missing_scope")
+	directory := NewUserDirectory(source)
+
+	if u, err := directory.Get("U1"); err != nil || u.Name != "bob" {
+		t.Fatalf("got %v, %v; want bob, asked about on their own", u, err)
+	}
+	directory.Get("U1")
+	if source.calls["users.info"] != 1 {
+		t.Errorf("looked bob up %d times; want once", source.calls["users.info"])
+	}
+}
+
+func TestUserDirectoryResolve(t *testing.T) {
+	source := newFakeUserSource(
+		slack.User{Id: "U1", Name: "bob"},
+		slack.User{Id: "U2", Name: "amy"},
+		slack.User{Id: "U3", Name: "cat"})
+	source.groups = []userGroup{{Id: "S1", Handle: "designers", Users: []string{"U3", "U1"}}}
+	directory := NewUserDirectory(source)
+
+	tests := []struct {
+		refs []string
+		want []string
+	}{
+		{[]string{"U2", "@bob"}, []string{"U2", "U1"}},
+		{[]string{"amy", "designers"}, []string{"U2", "U3", "U1"}},
+		// once each
+		{[]string{"@designers", "S1", "cat"}, []string{"U3", "U1"}},
+		{[]string{"nobody", "amy"}, []string{"U2"}},
+	}
+	for _, test := range tests {
+		if got := directory.Resolve(test.refs); !equalStrings(got, test.want) {
+			t.Errorf("Resolve(%q) = %q; want %q", test.refs, got, test.want)
+		}
+	}
+}
+
+func TestUserDirectoryUserGroups(t *testing.T) {
+	source := newFakeUserSource()
+	source.groupsErr = errors.New("missing_scope")
+	directory := NewUserDirectory(source)
+
+	if groups := directory.UserGroups(); len(groups) != 0 {
+		t.Errorf("got %v without the scope; want none", groups)
+	}
+	// don't keep asking
+	directory.UserGroups()
+	if source.calls["usergroups.list"] != 1 {
+		t.Errorf("listed user groups %d times; want once", source.calls["usergroups.list"])
+	}
+
+	source.groupsErr = nil
+	source.groups = []userGroup{{Id: "S1", Handle: "designers"}}
+	directory.groupsLoaded = time.Now().Add(-userGroupsMaxAge)
+	if groups := directory.UserGroups(); len(groups) != 1 {
+		t.Errorf("got %v once they were too old; want them listed again", groups)
+	}
+}
+
+func TestKnownUsersAreRefreshed(t *testing.T) {
+	b := newTestBot(t, slack.User{Id: "U1", Name: "bob"}, slack.User{Id: "U2", Name: "amy"})
+	defer b.Close()
+
+	s := b.start(t, testChannel("C1", "design", "U1", "U2"), "U1", "U2")
+	s.End()
+	b.waitReported(t)
+
+	// Slack tells us they've been deactivated
+	b.users.directory.Update(slack.User{Id: "U1", Name: "bob", Deleted: true})
+	s, err := b.standups.Start(testChannel("C2", "ops", "U1", "U2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "amy to be asked again", func() bool { return countOf(b.slack.DMs("U2"), Questions[0]) == 2 })
+	s.End()
+	b.waitReported(t)
+
+	if !equalStrings(s.excluded, []string{"U1"}) || s.exclusions["U1"] != "their account is deactivated" {
+		t.Errorf("excluded %q, %v; want bob, since he's been deactivated", s.excluded, s.exclusions)
+	}
+	if n := countOf(b.slack.DMs("U1"), Questions[0]); n != 1 {
+		t.Errorf("bob was asked %d times; want once, before he was deactivated", n)
+	}
+}
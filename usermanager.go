@@ -2,18 +2,30 @@ package main
 
 import (
 	"github.com/abourget/slack"
-	"log"
 	"sync"
+	"time"
 )
 
 type UserManager struct {
 	client             *AuthedSlack
+	history            *History
+	preferences        *Preferences
+	calendars          *Calendars
+	directory          *UserDirectory
+	standups           *StandupManager
 	messageReplies     chan slack.MessageEvent
+	presenceChanges    chan slack.PresenceChangeEvent
+	typing             chan slack.UserTypingEvent
+	imLists            chan []slack.IM
+	imChanges          chan imChange
 	newStandups        chan newStandupForUser
+	lookups            chan userLookup
+	skips              chan newStandupForUser
+	lookingUp          map[string][]newStandupForUser
 	usersByUserId      map[string]*User
 	usersByIMChannelId map[string]*User
 	userIdBlacklist    map[string]bool
-	channelIdBlacklist map[string]bool
+	ims                *imDirectory
 	userListWaitMutex  sync.Mutex
 }
 
@@ -21,37 +33,100 @@ type newStandupForUser struct {
 	standup *Standup
 	userId  string
 	reply   chan bool
+	result  chan standupStart
 }
 
-func NewUserManager(client *AuthedSlack) (um *UserManager) {
+// userLookup is what we found out about someone new, off in a goroutine of
+// its own so we can look up lots of people at once.
+type userLookup struct {
+	userId      string
+	info        *slack.User
+	imChannelId string
+	imOpened    bool
+	err         error
+}
+
+type standupStartResult int
+
+const (
+	standupStarted standupStartResult = iota
+	standupNotStarted
+	standupUserOnLeave
+	standupUserAway
+	standupUserExcluded
+)
+
+type standupStart struct {
+	result standupStartResult
+	// why they were excluded, if they were
+	reason string
+}
+
+func NewUserManager(client *AuthedSlack, history *History, preferences *Preferences, calendars *Calendars) (um *UserManager) {
 	um = &UserManager{
 		client:             client,
+		history:            history,
+		preferences:        preferences,
+		calendars:          calendars,
+		directory:          NewUserDirectory(client),
 		messageReplies:     make(chan slack.MessageEvent),
+		presenceChanges:    make(chan slack.PresenceChangeEvent),
+		typing:             make(chan slack.UserTypingEvent),
+		imLists:            make(chan []slack.IM),
+		imChanges:          make(chan imChange),
 		newStandups:        make(chan newStandupForUser),
+		lookups:            make(chan userLookup),
+		skips:              make(chan newStandupForUser),
+		lookingUp:          make(map[string][]newStandupForUser),
 		usersByUserId:      make(map[string]*User),
 		usersByIMChannelId: make(map[string]*User),
 		userIdBlacklist:    make(map[string]bool),
-		channelIdBlacklist: make(map[string]bool),
+		ims:                newIMDirectory(),
 	}
 	um.userListWaitMutex.Lock()
 	go um.start()
 	return
 }
 
-func (self *UserManager) StartStandup(s *Standup, userId string) (ok bool) {
-	reply := make(chan bool, 1)
+func (self *UserManager) StartStandup(s *Standup, userId string) standupStart {
+	result := make(chan standupStart, 1)
 	self.newStandups <- newStandupForUser{standup: s, userId: userId,
-		reply: reply}
-	ok = <-reply
-	return ok
+		result: result}
+	return <-result
+}
+
+// SkipStandup skips a user out of a stand-up they've been asked to, if they
+// have been and haven't finished it.
+func (self *UserManager) SkipStandup(s *Standup, userId string) (ok bool) {
+	reply := make(chan bool, 1)
+	self.skips <- newStandupForUser{standup: s, userId: userId, reply: reply}
+	return <-reply
 }
 
 func (self *UserManager) ReceiveMessageReply(m slack.MessageEvent) {
 	self.messageReplies <- m
 }
 
+func (self *UserManager) ReceivePresenceChange(p slack.PresenceChangeEvent) {
+	self.presenceChanges <- p
+}
+
+func (self *UserManager) ReceiveTyping(t slack.UserTypingEvent) {
+	self.typing <- t
+}
+
+// ReceiveIMs replaces what we know about IM channels with the list Slack
+// gives us when we connect.
+func (self *UserManager) ReceiveIMs(ims []slack.IM) {
+	self.imLists <- ims
+}
+
+func (self *UserManager) ReceiveIMChange(channelId, userId string, open bool) {
+	self.imChanges <- imChange{channelId: channelId, userId: userId, open: open}
+}
+
 func (self *UserManager) start() {
-	DebugLog.Println("UserManager started")
+	Log.Debugf("UserManager started")
 
 	var user *User
 	var err error
@@ -65,80 +140,175 @@ func (self *UserManager) start() {
 			if user, ok = self.usersByIMChannelId[m.ChannelId]; !ok {
 				user, err = self.lookupUserByIMChannelId(m.ChannelId)
 				if err != nil {
-					log.Printf(
+					Log.With("user_id", m.UserId).With("channel_id", m.ChannelId).Errorf(
 						"error getting channel info; message dropped: %s", err)
 					continue
 				}
 				if user == nil {
 					continue
 				} else {
-					self.usersByUserId[user.Info.Id] = user
+					self.usersByUserId[user.Info().Id] = user
 					self.usersByIMChannelId[m.ChannelId] = user
 				}
 			}
-			DebugLog.Printf("delivering message %s to user %s", m.Timestamp, user.Info.Name)
+			user.logger.Debugf("delivering message %s", m.Timestamp)
 			user.ReceiveMessageReply(m)
 
+		case p := <-self.presenceChanges:
+			// we only care about people we've asked something
+			if user, ok = self.usersByUserId[p.UserId]; ok {
+				user.PresenceChanged(p.Presence)
+			}
+
+		case t := <-self.typing:
+			// only to us, by people we've asked something
+			if user, ok = self.usersByIMChannelId[t.ChannelId]; ok {
+				user.Typing()
+			}
+
+		case ims := <-self.imLists:
+			self.ims.reset(ims)
+
+		case c := <-self.imChanges:
+			self.ims.change(c)
+
 		case ns := <-self.newStandups:
-			if user, ok = self.usersByUserId[ns.userId]; !ok {
-				user, err = self.lookupUserById(ns.userId)
-				if err != nil {
-					log.Printf("error getting user info; new standup dropped: %s", err)
-					ns.reply <- false
-					continue
+			if self.userIdBlacklist[ns.userId] {
+				ns.result <- standupStart{result: standupNotStarted}
+				continue
+			}
+			// even people we know, since they may have changed timezone
+			// or been deactivated since we last asked them
+			waiting, pending := self.lookingUp[ns.userId]
+			self.lookingUp[ns.userId] = append(waiting, ns)
+			if !pending {
+				channelId, open := self.ims.channelId(ns.userId)
+				if user, ok = self.usersByUserId[ns.userId]; ok {
+					channelId, open = user.imChannelId, true
 				}
-				if user == nil {
-					ns.reply <- false
-					continue
-				} else {
-					self.usersByUserId[ns.userId] = user
-					self.usersByIMChannelId[user.imChannelId] = user
+				go self.lookUpUser(ns.userId, channelId, open)
+			}
+
+		case l := <-self.lookups:
+			waiting := self.lookingUp[l.userId]
+			delete(self.lookingUp, l.userId)
+
+			if user, ok = self.usersByUserId[l.userId]; !ok {
+				user = self.addLookedUpUser(l)
+			} else if l.err != nil {
+				user.logger.Warnf("error refreshing user info; using what we had: %s", l.err)
+				info := user.Info()
+				l.info, l.err = &info, nil
+			} else {
+				user.setInfo(*l.info)
+			}
+			for _, ns := range waiting {
+				switch {
+				case l.err != nil:
+					ns.standup.logger.With("user_id", l.userId).Errorf("error getting user info; new standup dropped: %s", l.err)
+					ns.result <- standupStart{result: standupNotStarted}
+				case l.info.IsBot:
+					ns.result <- standupStart{result: standupNotStarted}
+				default:
+					self.startStandup(*l.info, user, ns)
 				}
 			}
-			user.StartStandup(ns.standup)
-			ns.reply <- true
+
+		case sk := <-self.skips:
+			if user, ok = self.usersByUserId[sk.userId]; !ok {
+				sk.reply <- false
+				continue
+			}
+			// they know whether they've anything to skip, but we mustn't
+			// wait on them to find out
+			go func(user *User, sk newStandupForUser) {
+				sk.reply <- user.SkipStandup(sk.standup)
+			}(user, sk)
 		}
 	}
 }
 
 func (self *UserManager) lookupUserByIMChannelId(channelId string) (user *User, err error) {
-	if self.channelIdBlacklist[channelId] {
+	userId, ok := self.ims.userId(channelId)
+	if !ok {
+		// the message may have beaten Slack telling us about the channel
+		ims, err := self.client.GetIMChannels()
+		if err != nil {
+			return nil, err
+		}
+		for _, im := range ims {
+			self.ims.add(im.Id, im.UserId, im.IsOpen)
+		}
+		if userId, ok = self.ims.userId(channelId); !ok {
+			return nil, nil
+		}
+	}
+	if self.userIdBlacklist[userId] {
 		return nil, nil
 	}
+	return self.newUser(userId, channelId)
+}
 
-	/* TODO: we could do better here, tracking opening and closing
-	 * of IM channels with the RTM API
-	 */
-	ims, err := self.client.GetIMChannels()
-	if err != nil {
+/* startStandup asks someone to a stand-up, unless they've said not to, the
+ * channel's policy leaves them out or they're away, all on the day they'd be
+ * asked. We never make a User for a deactivated account, since they'll
+ * always be left out.
+ */
+// must only be called from our own goroutine
+func (self *UserManager) startStandup(info slack.User, user *User, ns newStandupForUser) {
+	start := ns.standup.startTimeFor(info, time.Now())
+	if self.preferences != nil && self.preferences.Get(info.Id).OnLeave(ns.standup.Channel.Id, start) {
+		ns.result <- standupStart{result: standupUserOnLeave}
 		return
 	}
-	for _, im := range ims {
-		if im.Id == channelId {
-			user, err = self.newUser(im.UserId, im.Id)
-			if user == nil && err == nil {
-				self.channelIdBlacklist[channelId] = true
-			}
-			return
-		}
+	if reason, excluded := ns.standup.config.Excludes(info, ns.standup.userGroups); excluded {
+		ns.result <- standupStart{result: standupUserExcluded, reason: reason}
+		return
 	}
-	return
+	if user == nil {
+		ns.result <- standupStart{result: standupNotStarted}
+		return
+	}
+	if self.calendars.Away(info, start) {
+		ns.result <- standupStart{result: standupUserAway}
+		return
+	}
+	user.StartStandup(ns.standup)
+	ns.result <- standupStart{result: standupStarted}
 }
 
-func (self *UserManager) lookupUserById(userId string) (user *User, err error) {
-	if self.userIdBlacklist[userId] {
-		return nil, nil
+// lookUpUser runs in a goroutine of its own, and reports back to ours.
+func (self *UserManager) lookUpUser(userId, imChannelId string, imOpen bool) {
+	l := userLookup{userId: userId, imChannelId: imChannelId}
+	l.info, l.err = self.directory.Get(userId)
+	// we open closed IMs so people can see what we're asking them
+	if l.err == nil && !l.info.IsBot && !l.info.Deleted && !imOpen {
+		_, _, l.imChannelId, l.err = self.client.OpenIMChannel(userId)
+		l.imOpened = true
 	}
+	self.lookups <- l
+}
 
-	_, _, channelId, err := self.client.OpenIMChannel(userId)
-	if err != nil {
-		return nil, err
+// must only be called from our own goroutine
+func (self *UserManager) addLookedUpUser(l userLookup) *User {
+	switch {
+	case l.err != nil, l.info.Deleted:
+		return nil
+	case l.info.IsBot:
+		self.userIdBlacklist[l.userId] = true
+		return nil
 	}
-	return self.newUser(userId, channelId)
+	if l.imOpened {
+		self.ims.add(l.imChannelId, l.userId, true)
+	}
+	user := NewUser(self, *l.info, l.imChannelId)
+	self.usersByUserId[l.userId] = user
+	self.usersByIMChannelId[l.imChannelId] = user
+	return user
 }
 
 func (self *UserManager) newUser(userId string, imChannelId string) (user *User, err error) {
-	userInfo, err := self.client.GetUserInfo(userId)
+	userInfo, err := self.directory.Get(userId)
 	if err != nil {
 		return nil, err
 	}
@@ -146,5 +316,5 @@ func (self *UserManager) newUser(userId string, imChannelId string) (user *User,
 		self.userIdBlacklist[userInfo.Id] = true
 		return nil, nil
 	}
-	return NewUser(self.client, *userInfo, imChannelId), nil
+	return NewUser(self, *userInfo, imChannelId), nil
 }